@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// newPostsChannel is the Postgres notification channel new posts are
+// announced on when several instances run.
+const newPostsChannel = "new_posts"
+
+// postSubscriberBuffer is how many posts a stream can fall behind before it
+// is dropped.
+const postSubscriberBuffer = 64
+
+// postPublisher is told about every post the scraper stores.
+type postPublisher interface {
+	publishPost(ctx context.Context, post database.Post)
+}
+
+// postBroker hands the posts stored by the scraper to the open post streams
+// of this instance.
+type postBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan database.Post]struct{}
+}
+
+func newPostBroker() *postBroker {
+	return &postBroker{subscribers: map[chan database.Post]struct{}{}}
+}
+
+func (b *postBroker) subscribe() chan database.Post {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	posts := make(chan database.Post, postSubscriberBuffer)
+	b.subscribers[posts] = struct{}{}
+	return posts
+}
+
+func (b *postBroker) unsubscribe(posts chan database.Post) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[posts]; ok {
+		delete(b.subscribers, posts)
+		close(posts)
+	}
+}
+
+// publishPost never blocks the scraper: subscribers too slow to keep up are
+// dropped, their channel is closed and the client resumes from the last post
+// it got.
+func (b *postBroker) publishPost(ctx context.Context, post database.Post) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for posts := range b.subscribers {
+		select {
+		case posts <- post:
+		default:
+			delete(b.subscribers, posts)
+			close(posts)
+		}
+	}
+}
+
+// postNotifier announces the posts stored by this instance with NOTIFY, every
+// instance listening with listenForNewPosts passes them on to its broker,
+// this one included.
+type postNotifier struct {
+	db *database.Queries
+}
+
+func (n *postNotifier) publishPost(ctx context.Context, post database.Post) {
+	// Payloads are limited to 8000 bytes, listeners load the post themselves
+	if err := n.db.NotifyNewPost(ctx, post.ID.String()); err != nil {
+		log.Println("Error notifying new post: ", fmt.Errorf("error notifying new post: %w", err))
+	}
+}
+
+// listenForNewPosts passes the posts announced on newPostsChannel on to the
+// broker. Posts announced while the connection is down are missed.
+func listenForNewPosts(dbURL string, db *database.Queries, broker *postBroker) {
+	listener := pq.NewListener(dbURL, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Error listening for new posts: ", err)
+		}
+	})
+	if err := listener.Listen(newPostsChannel); err != nil {
+		log.Println("Error listening for new posts: ", fmt.Errorf("error listening on %s: %w", newPostsChannel, err))
+		return
+	}
+
+	ctx := context.Background()
+	for {
+		select {
+		case notification := <-listener.Notify:
+			// nil after the connection has been reestablished
+			if notification == nil {
+				continue
+			}
+
+			postID, err := uuid.Parse(notification.Extra)
+			if err != nil {
+				log.Println("Error parsing new post notification: ", fmt.Errorf("error parsing post ID %q: %w", notification.Extra, err))
+				continue
+			}
+
+			post, err := db.GetPostByID(ctx, postID)
+			if err != nil {
+				log.Println("Error getting new post: ", fmt.Errorf("error getting post %s: %w", postID, err))
+				continue
+			}
+
+			broker.publishPost(ctx, post)
+		case <-time.After(90 * time.Second):
+			// Checks the connection is still alive when nothing is announced
+			go listener.Ping()
+		}
+	}
+}
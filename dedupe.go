@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// storyWindow bounds how far back fingerprints are compared, the same
+	// story rarely gets republished days apart.
+	storyWindow = 72 * time.Hour
+	// maxFingerprintDistance is the number of differing bits below which two
+	// fingerprints are considered the same story.
+	maxFingerprintDistance = 3
+	// minFingerprintTokens avoids clustering short, generic titles
+	// ("Weekly update") on their fingerprint alone.
+	minFingerprintTokens = 8
+)
+
+// simhash computes a 64-bit SimHash of text, where near-identical texts
+// produce fingerprints that differ in only a few bits. The second return
+// value is false when the text is too short for the fingerprint to be
+// meaningful.
+func simhash(text string) (int64, bool) {
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(tokens) < minFingerprintTokens {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := range tokens {
+		// Word pairs keep some of the word order in the fingerprint.
+		shingle := tokens[i]
+		if i+1 < len(tokens) {
+			shingle += " " + tokens[i+1]
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(shingle))
+		sum := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return int64(fingerprint), true
+}
+
+// findStoryCluster returns the cluster an incoming post belongs to: the
+// cluster of an existing post with the same canonical URL or a close enough
+// fingerprint, or a new cluster identified by postID.
+func findStoryCluster(ctx context.Context, db *database.Queries, postID uuid.UUID, canonicalURL string, fingerprint sql.NullInt64, publishedAt time.Time) (uuid.UUID, error) {
+	clusterID, err := db.FindPostCluster(ctx, database.FindPostClusterParams{
+		CanonicalUrl:   sql.NullString{String: canonicalURL, Valid: canonicalURL != ""},
+		PublishedAfter: publishedAt.Add(-storyWindow),
+		Fingerprint:    fingerprint,
+		MaxDistance:    maxFingerprintDistance,
+	})
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !clusterID.Valid) {
+		return postID, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return clusterID.UUID, nil
+}
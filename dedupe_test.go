@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+func TestSimhash(t *testing.T) {
+	const story = "Rust 1.80 released with lazy cell and lazy lock stabilized. " +
+		"The Rust team is happy to announce a new version of Rust. Rust is a programming " +
+		"language empowering everyone to build reliable and efficient software. If you have " +
+		"a previous version of Rust installed via rustup, you can get 1.80 with rustup update stable."
+
+	tests := []struct {
+		name   string
+		a, b   string
+		wantOK bool
+		// same reports whether the fingerprints should be within
+		// maxFingerprintDistance of each other
+		same bool
+	}{
+		{name: "identical", a: story, b: story, wantOK: true, same: true},
+		{name: "case and punctuation", a: story, b: strings.NewReplacer(".", "!", " with", ", with").Replace(strings.ToUpper(story)), wantOK: true, same: true},
+		{name: "whitespace", a: story, b: "  " + strings.ReplaceAll(story, " ", "\n\t") + "\n", wantOK: true, same: true},
+		{name: "different story", a: story, b: "Postgres 17 ships incremental backups and faster vacuum for large tables", wantOK: true, same: false},
+		{name: "too short", a: "Weekly update", b: "Weekly update", wantOK: false},
+		{name: "empty", a: "", b: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, okA := simhash(tt.a)
+			b, okB := simhash(tt.b)
+			if okA != tt.wantOK || okB != tt.wantOK {
+				t.Fatalf("simhash ok = %v, %v, want %v", okA, okB, tt.wantOK)
+			}
+			if !tt.wantOK {
+				return
+			}
+
+			distance := bits.OnesCount64(uint64(a ^ b))
+			if same := distance <= maxFingerprintDistance; same != tt.same {
+				t.Errorf("distance between fingerprints = %d, want same story = %v", distance, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// feedTypes maps the link types advertised by websites to the feed format.
+var feedTypes = map[string]string{
+	"application/rss+xml":   "rss",
+	"application/atom+xml":  "atom",
+	"application/feed+json": "json",
+	"application/json":      "json",
+}
+
+// commonFeedPaths are probed when a page doesn't advertise any feed.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml"}
+
+var errNoFeedFound = errors.New("no feed found")
+
+type FeedCandidate struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+}
+
+// discoverFeeds returns the feeds available at pageURL. When pageURL is
+// already a feed it is returned as the only candidate, when it is an HTML page
+// the feeds it links to are returned, falling back to well-known feed paths.
+// RSS feeds are listed first since they are the ones the scraper can read.
+func discoverFeeds(ctx context.Context, client *fetcher, pageURL string) ([]FeedCandidate, error) {
+	resp, err := client.get(ctx, pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errFeedUnreachable, err)
+	}
+
+	finalURL := resp.Request.URL
+	body := bufio.NewReader(io.LimitReader(resp.Body, maxArticleSize))
+	head, _ := body.Peek(512)
+
+	if feedType := detectFeedType(resp.Header.Get("Content-Type"), head); feedType != "" {
+		resp.Body.Close()
+		return []FeedCandidate{{URL: finalURL.String(), Type: feedType}}, nil
+	}
+
+	doc, err := html.Parse(body)
+	// Close right away, probing below needs a request slot for the same host
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := linkedFeeds(doc, finalURL)
+	if len(candidates) == 0 {
+		candidates = probeFeedPaths(ctx, client, finalURL)
+	}
+	if len(candidates) == 0 {
+		return nil, errNoFeedFound
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Type == "rss" && candidates[j].Type != "rss"
+	})
+	return candidates, nil
+}
+
+// linkedFeeds collects the <link rel="alternate"> feeds of an HTML document.
+func linkedFeeds(doc *html.Node, pageURL *url.URL) []FeedCandidate {
+	var candidates []FeedCandidate
+	seen := map[string]bool{}
+	base := pageURL
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "base" {
+			base = parseBaseURL(base, attribute(n, "href"))
+		}
+
+		if n.Type == html.ElementNode && n.Data == "link" && hasToken(attribute(n, "rel"), "alternate") {
+			mediaType, _, _ := mime.ParseMediaType(attribute(n, "type"))
+			feedType, ok := feedTypes[mediaType]
+			href := resolveURL(base, attribute(n, "href"))
+			if ok && href != "" && !seen[href] {
+				seen[href] = true
+				candidates = append(candidates, FeedCandidate{
+					URL:   href,
+					Title: strings.TrimSpace(attribute(n, "title")),
+					Type:  feedType,
+				})
+			}
+		}
+
+		// Feed links only ever live in the document head.
+		if n.Type == html.ElementNode && n.Data == "body" {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return candidates
+}
+
+// probeFeedPaths tries the well-known feed locations of a site.
+func probeFeedPaths(ctx context.Context, client *fetcher, siteURL *url.URL) []FeedCandidate {
+	var candidates []FeedCandidate
+	for _, path := range commonFeedPaths {
+		candidateURL := siteURL.ResolveReference(&url.URL{Path: path}).String()
+
+		resp, err := client.get(ctx, candidateURL)
+		if err != nil {
+			continue
+		}
+
+		head, _ := bufio.NewReader(resp.Body).Peek(512)
+		feedType := detectFeedType(resp.Header.Get("Content-Type"), head)
+		resp.Body.Close()
+
+		if feedType != "" {
+			candidates = append(candidates, FeedCandidate{URL: resp.Request.URL.String(), Type: feedType})
+		}
+	}
+	return candidates
+}
+
+// detectFeedType tells whether a response is a feed from its content type
+// and, since many servers send feeds as text/xml or text/plain, from the
+// first bytes of the body. It returns an empty string for anything else.
+func detectFeedType(contentType string, head []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if feedType, ok := feedTypes[mediaType]; ok && mediaType != "application/json" {
+		return feedType
+	}
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return ""
+	}
+
+	head = bytes.ToLower(head)
+	switch {
+	case bytes.Contains(head, []byte("<rss")) || bytes.Contains(head, []byte("<rdf:rdf")):
+		return "rss"
+	case bytes.Contains(head, []byte("<feed")):
+		return "atom"
+	case bytes.Contains(head, []byte("jsonfeed.org/version")):
+		return "json"
+	}
+	return ""
+}
+
+// hasToken reports whether a space separated attribute value such as rel
+// contains token.
+func hasToken(value string, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
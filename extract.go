@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxArticleSize caps how much of an article page is read, pages larger than
+// this are almost always not articles.
+const maxArticleSize = 5 << 20
+
+// article is the readable part of a web page.
+type article struct {
+	// Content is the main content of the page as (unsanitized) HTML, with
+	// absolute URLs.
+	Content string
+	// CanonicalURL is the page's rel=canonical link, if any.
+	CanonicalURL string
+}
+
+// boilerplateElements never contain the main content of a page.
+var boilerplateElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "iframe": true, "form": true,
+	"nav": true, "header": true, "footer": true, "aside": true, "button": true,
+	"svg": true, "template": true,
+}
+
+var positiveHints = []string{"article", "body", "content", "entry", "main", "page", "post", "story", "text"}
+var negativeHints = []string{"ad-", "ads", "banner", "comment", "footer", "menu", "nav", "promo", "related", "share", "sidebar", "social", "sponsor", "widget"}
+
+// fetchArticle downloads the page at pageURL and extracts its main content.
+func fetchArticle(ctx context.Context, client *fetcher, pageURL string) (article, error) {
+	resp, err := client.get(ctx, pageURL)
+	if err != nil {
+		return article{}, err
+	}
+	defer resp.Body.Close()
+
+	doc, err := html.Parse(io.LimitReader(resp.Body, maxArticleSize))
+	if err != nil {
+		return article{}, err
+	}
+
+	return extractArticle(doc, resp.Request.URL), nil
+}
+
+// extractArticle finds the element holding the main content of a page using
+// readability-style scoring: paragraphs give points to their parent and
+// grandparent based on how much text they hold, class and id names nudge the
+// score up or down, and link-heavy elements are penalized.
+func extractArticle(doc *html.Node, pageURL *url.URL) article {
+	var result article
+	base := pageURL
+
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "base":
+				base = parseBaseURL(base, attribute(n, "href"))
+			case n.Data == "link" && hasToken(attribute(n, "rel"), "canonical"):
+				result.CanonicalURL = resolveURL(base, attribute(n, "href"))
+			case boilerplateElements[n.Data]:
+				return
+			case n.Data == "p" || n.Data == "pre" || n.Data == "td":
+				text := nodeText(n)
+				if len(text) >= 25 && n.Parent != nil {
+					score := 1 + float64(strings.Count(text, ",")) + float64(minInt(len(text)/100, 3))
+					for i, ancestor := range []*html.Node{n.Parent, n.Parent.Parent} {
+						if ancestor == nil || ancestor.Type != html.ElementNode {
+							continue
+						}
+						if _, ok := scores[ancestor]; !ok {
+							scores[ancestor] = classWeight(ancestor)
+							candidates = append(candidates, ancestor)
+						}
+						if i == 0 {
+							scores[ancestor] += score
+						} else {
+							scores[ancestor] += score / 2
+						}
+					}
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, candidate := range candidates {
+		score := scores[candidate] * (1 - linkDensity(candidate))
+		if best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best == nil {
+		return result
+	}
+
+	var buf bytes.Buffer
+	for c := best.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && boilerplateElements[c.Data] {
+			continue
+		}
+		html.Render(&buf, c)
+	}
+	result.Content = resolveHTMLURLs(base, buf.String())
+
+	return result
+}
+
+// classWeight scores an element on the hints found in its class and id.
+func classWeight(n *html.Node) float64 {
+	hints := strings.ToLower(attribute(n, "class") + " " + attribute(n, "id"))
+	weight := 0.0
+	for _, hint := range positiveHints {
+		if strings.Contains(hints, hint) {
+			weight += 25
+			break
+		}
+	}
+	for _, hint := range negativeHints {
+		if strings.Contains(hints, hint) {
+			weight -= 25
+			break
+		}
+	}
+	if n.Data == "article" || n.Data == "main" {
+		weight += 10
+	}
+	return weight
+}
+
+// linkDensity is the share of an element's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+
+	linked := 0
+	var walk func(c *html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			linked += len(nodeText(c))
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return float64(linked) / float64(total)
+}
+
+// nodeText returns the text of n and its descendants with whitespace collapsed.
+func nodeText(n *html.Node) string {
+	var buf strings.Builder
+	var walk func(c *html.Node)
+	walk = func(c *html.Node) {
+		switch {
+		case c.Type == html.TextNode:
+			buf.WriteString(c.Data)
+			buf.WriteString(" ")
+		case c.Type == html.ElementNode && boilerplateElements[c.Data]:
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func attribute(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fetchTimeout = 10 * time.Second
+const maxRequestsPerHost = 2
+const userAgent = "rss-aggregator/1.0 (+https://github.com/darthvadr/rss-aggregator)"
+
+// fetcher is the HTTP client shared by everything that reaches out to
+// publishers. It applies a single timeout, caps the number of concurrent
+// requests to the same host so we don't hammer small sites and only connects
+// to public addresses.
+type fetcher struct {
+	client  *http.Client
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+// hostSlots is the semaphore guarding requests to a host. users counts the
+// requests holding or waiting for a slot, the entry is dropped once it is
+// back to zero so hosts fetched once don't stay in the map.
+type hostSlots struct {
+	slots chan struct{}
+	users int
+}
+
+func newFetcher(timeout time.Duration, perHost int, guard addressGuard) *fetcher {
+	return &fetcher{
+		client:  &http.Client{Timeout: timeout, Transport: guard.transport()},
+		perHost: perHost,
+		hosts:   map[string]*hostSlots{},
+	}
+}
+
+// joinHost returns the semaphore guarding requests to host, counting the
+// caller as one of its users until it calls leaveHost.
+func (f *fetcher) joinHost(host string) *hostSlots {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	slots, ok := f.hosts[host]
+	if !ok {
+		slots = &hostSlots{slots: make(chan struct{}, f.perHost)}
+		f.hosts[host] = slots
+	}
+	slots.users++
+	return slots
+}
+
+// leaveHost forgets a user of the host's semaphore, deleting it when it was
+// the last one.
+func (f *fetcher) leaveHost(host string, slots *hostSlots) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	slots.users--
+	if slots.users == 0 {
+		delete(f.hosts, host)
+	}
+}
+
+// get performs a GET request once a slot for the target host is available.
+// The slot is held until the response body is closed, so callers must always
+// close it. Responses with a non-2xx status are returned as errors.
+func (f *fetcher) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+
+	host := strings.ToLower(parsed.Host)
+	slots := f.joinHost(host)
+	select {
+	case slots.slots <- struct{}{}:
+	case <-ctx.Done():
+		f.leaveHost(host, slots)
+		return nil, ctx.Err()
+	}
+	release := func() {
+		<-slots.slots
+		f.leaveHost(host, slots)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		release()
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, rawURL)
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody frees the host slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
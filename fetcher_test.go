@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetcherForgetsIdleHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := newFetcher(fetchTimeout, 1, addressGuard{allowPrivate: true})
+
+	tests := []struct {
+		name    string
+		request func(t *testing.T)
+	}{
+		{
+			name: "body closed",
+			request: func(t *testing.T) {
+				resp, err := f.get(context.Background(), server.URL)
+				if err != nil {
+					t.Fatalf("get() error = %v", err)
+				}
+				if len(f.hosts) != 1 {
+					t.Errorf("hosts while the body is open = %d, want 1", len(f.hosts))
+				}
+				resp.Body.Close()
+			},
+		},
+		{
+			name: "error status",
+			request: func(t *testing.T) {
+				if _, err := f.get(context.Background(), server.URL+"/missing"); err == nil {
+					t.Error("get() error = nil, want an error")
+				}
+			},
+		},
+		{
+			name: "cancelled while waiting for a slot",
+			request: func(t *testing.T) {
+				held, err := f.get(context.Background(), server.URL)
+				if err != nil {
+					t.Fatalf("get() error = %v", err)
+				}
+				defer held.Body.Close()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				if _, err := f.get(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("get() error = %v, want %v", err, context.DeadlineExceeded)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request(t)
+
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if len(f.hosts) != 0 {
+				t.Errorf("hosts after the request = %d, want 0", len(f.hosts))
+			}
+		})
+	}
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const maxSlugLength = 64
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// slugify derives a slug from a collection name: lowercase letters and digits
+// separated by single dashes.
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	return slug
+}
+
+func (apiConfig *apiConfig) handlerCreateCollection(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		// Slug is derived from the name when left out
+		Slug    string      `json:"slug"`
+		FeedIDs []uuid.UUID `json:"feed_ids"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		responseWithError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	if params.Slug == "" {
+		params.Slug = slugify(params.Name)
+	}
+	if len(params.Slug) > maxSlugLength || !slugPattern.MatchString(params.Slug) {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf("slug must be at most %d lowercase letters, digits and single dashes", maxSlugLength))
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Println("Error starting transaction: ", fmt.Errorf("error starting transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating collection")
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiConfig.DB.WithTx(tx)
+
+	collection, err := qtx.CreateCollection(r.Context(), database.CreateCollectionParams{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Slug:        params.Slug,
+		Name:        params.Name,
+		Description: sql.NullString{String: params.Description, Valid: params.Description != ""},
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		responseWithError(w, http.StatusConflict, "slug is already taken")
+		return
+	}
+	if err != nil {
+		log.Println("Error creating collection: ", fmt.Errorf("error creating collection: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating collection")
+		return
+	}
+
+	if len(params.FeedIDs) > 0 {
+		if _, err := qtx.AddCollectionFeeds(r.Context(), database.AddCollectionFeedsParams{
+			CollectionID: collection.ID,
+			FeedIds:      params.FeedIDs,
+		}); err != nil {
+			log.Println("Error adding collection feeds: ", fmt.Errorf("error adding collection feeds: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error creating collection")
+			return
+		}
+	}
+
+	feeds, err := qtx.GetCollectionFeeds(r.Context(), collection.ID)
+	if err != nil {
+		log.Println("Error getting collection feeds: ", fmt.Errorf("error getting collection feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating collection")
+		return
+	}
+
+	// Only feeds the owner follows can be collected, a collection makes a
+	// feed shared and the user who added it can't change it anymore
+	if id, missing := missingFeed(feeds, params.FeedIDs); missing {
+		responseWithError(w, http.StatusNotFound, fmt.Sprintf("feed %s not found among the feeds you follow", id))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction: ", fmt.Errorf("error committing transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating collection")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToCollection(collection, feeds))
+}
+
+// handlerGetCollections lists the collections the user published.
+func (apiConfig *apiConfig) handlerGetCollections(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var dbCollections []database.Collection
+	if page.After != nil {
+		dbCollections, err = apiConfig.DB.GetCollectionsForUserAfter(r.Context(), database.GetCollectionsForUserAfterParams{
+			UserID:    user.ID,
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+	} else {
+		dbCollections, err = apiConfig.DB.GetCollectionsForUser(r.Context(), database.GetCollectionsForUserParams{
+			UserID:     user.ID,
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Println("Error listing collections: ", fmt.Errorf("error listing collections: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing collections")
+		return
+	}
+
+	dbCollections = paginate(w, r, page, dbCollections, func(dbCollection database.Collection) pageCursor {
+		return pageCursor{Time: dbCollection.CreatedAt.Time, ID: dbCollection.ID}
+	})
+
+	collectionIDs := make([]uuid.UUID, len(dbCollections))
+	for i, dbCollection := range dbCollections {
+		collectionIDs[i] = dbCollection.ID
+	}
+	dbFeeds, err := apiConfig.DB.GetFeedsForCollections(r.Context(), collectionIDs)
+	if err != nil {
+		log.Println("Error getting collection feeds: ", fmt.Errorf("error getting collection feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing collections")
+		return
+	}
+	feedsByCollection := map[uuid.UUID][]database.Feed{}
+	for _, dbFeed := range dbFeeds {
+		feedsByCollection[dbFeed.CollectionID] = append(feedsByCollection[dbFeed.CollectionID], dbFeed.Feed)
+	}
+
+	collections := make([]Collection, len(dbCollections))
+	for i, dbCollection := range dbCollections {
+		collections[i] = databaseToCollection(dbCollection, feedsByCollection[dbCollection.ID])
+	}
+
+	responseWithJSON(w, http.StatusOK, collections)
+}
+
+// handlerGetCollection returns a collection and its feeds. Collections are
+// public, no API key is needed.
+func (apiConfig *apiConfig) handlerGetCollection(w http.ResponseWriter, r *http.Request) {
+
+	collection, ok := apiConfig.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	feeds, err := apiConfig.DB.GetCollectionFeeds(r.Context(), collection.ID)
+	if err != nil {
+		log.Println("Error getting collection feeds: ", fmt.Errorf("error getting collection feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting collection")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToCollection(collection, feeds))
+}
+
+// handlerGetCollectionFeed publishes the posts of a collection's feeds as an
+// RSS, Atom or JSON feed.
+func (apiConfig *apiConfig) handlerGetCollectionFeed(w http.ResponseWriter, r *http.Request) {
+
+	format := chi.URLParam(r, "format")
+	if !isFeedFormat(format) {
+		responseWithError(w, http.StatusNotFound, errUnknownFeedFormat.Error())
+		return
+	}
+
+	collection, ok := apiConfig.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := publishedFeedLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, err := apiConfig.DB.GetPostsForCollection(r.Context(), database.GetPostsForCollectionParams{
+		CollectionID: collection.ID,
+		Limit:        limit,
+	})
+	if err != nil {
+		log.Println("Error getting collection posts: ", fmt.Errorf("error getting collection posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting posts")
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	feed := publishedFeed{
+		ID:      "urn:uuid:" + collection.ID.String(),
+		Title:   collection.Name,
+		HomeURL: baseURL + "v1/collections/" + collection.Slug,
+		SelfURL: baseURL + r.URL.RequestURI()[1:],
+		Updated: collection.UpdatedAt.Time,
+		Posts:   databasePostsToPosts(posts),
+	}
+	if len(posts) > 0 {
+		feed.Updated = posts[0].PublishedAt
+	}
+
+	writePublishedFeed(w, format, feed)
+}
+
+func (apiConfig *apiConfig) handlerUpdateCollection(w http.ResponseWriter, r *http.Request) {
+
+	// Fields left out of the payload are not changed
+	type parameters struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	collection, ok := apiConfig.ownedCollectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	update := database.UpdateCollectionParams{
+		ID:          collection.ID,
+		Name:        collection.Name,
+		Description: collection.Description,
+	}
+	if params.Name != nil {
+		update.Name = strings.TrimSpace(*params.Name)
+		if update.Name == "" {
+			responseWithError(w, http.StatusBadRequest, "name must not be empty")
+			return
+		}
+	}
+	if params.Description != nil {
+		update.Description = sql.NullString{String: *params.Description, Valid: *params.Description != ""}
+	}
+
+	updatedCollection, err := apiConfig.DB.UpdateCollection(r.Context(), update)
+	if err != nil {
+		log.Println("Error updating collection: ", fmt.Errorf("error updating collection: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating collection")
+		return
+	}
+
+	feeds, err := apiConfig.DB.GetCollectionFeeds(r.Context(), collection.ID)
+	if err != nil {
+		log.Println("Error getting collection feeds: ", fmt.Errorf("error getting collection feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating collection")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToCollection(updatedCollection, feeds))
+}
+
+// handlerDeleteCollection deletes a collection. Subscribers keep following
+// its feeds.
+func (apiConfig *apiConfig) handlerDeleteCollection(w http.ResponseWriter, r *http.Request) {
+
+	collection, ok := apiConfig.ownedCollectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := apiConfig.DB.DeleteCollection(r.Context(), database.DeleteCollectionParams{
+		ID:     collection.ID,
+		UserID: collection.UserID,
+	}); err != nil {
+		log.Println("Error deleting collection: ", fmt.Errorf("error deleting collection: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting collection")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerAddCollectionFeeds adds feeds to a collection. Subscribers tracking
+// the collection's additions start following them.
+func (apiConfig *apiConfig) handlerAddCollectionFeeds(w http.ResponseWriter, r *http.Request) {
+	apiConfig.changeCollectionFeeds(w, r, true)
+}
+
+// handlerRemoveCollectionFeeds removes feeds from a collection, subscribers
+// keep following them.
+func (apiConfig *apiConfig) handlerRemoveCollectionFeeds(w http.ResponseWriter, r *http.Request) {
+	apiConfig.changeCollectionFeeds(w, r, false)
+}
+
+func (apiConfig *apiConfig) changeCollectionFeeds(w http.ResponseWriter, r *http.Request, add bool) {
+
+	type parameters struct {
+		FeedIDs []uuid.UUID `json:"feed_ids"`
+	}
+
+	collection, ok := apiConfig.ownedCollectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if len(params.FeedIDs) == 0 {
+		responseWithError(w, http.StatusBadRequest, "feed_ids must not be empty")
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Println("Error starting transaction: ", fmt.Errorf("error starting transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating collection")
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiConfig.DB.WithTx(tx)
+
+	if add {
+		added, err := qtx.AddCollectionFeeds(r.Context(), database.AddCollectionFeedsParams{
+			CollectionID: collection.ID,
+			FeedIds:      params.FeedIDs,
+		})
+		if err == nil && len(added) > 0 {
+			_, err = qtx.FollowFeedsForTrackingSubscribers(r.Context(), database.FollowFeedsForTrackingSubscribersParams{
+				CollectionID: collection.ID,
+				FeedIds:      added,
+			})
+		}
+		if err != nil {
+			log.Println("Error adding collection feeds: ", fmt.Errorf("error adding collection feeds: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error updating collection")
+			return
+		}
+	} else {
+		if _, err := qtx.RemoveCollectionFeeds(r.Context(), database.RemoveCollectionFeedsParams{
+			CollectionID: collection.ID,
+			FeedIds:      params.FeedIDs,
+		}); err != nil {
+			log.Println("Error removing collection feeds: ", fmt.Errorf("error removing collection feeds: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error updating collection")
+			return
+		}
+	}
+
+	feeds, err := qtx.GetCollectionFeeds(r.Context(), collection.ID)
+	if err != nil {
+		log.Println("Error getting collection feeds: ", fmt.Errorf("error getting collection feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating collection")
+		return
+	}
+
+	// Feeds the owner doesn't follow can't be added, none of the others are
+	// then
+	if id, missing := missingFeed(feeds, params.FeedIDs); add && missing {
+		responseWithError(w, http.StatusNotFound, fmt.Sprintf("feed %s not found among the feeds you follow", id))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction: ", fmt.Errorf("error committing transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating collection")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToCollection(collection, feeds))
+}
+
+// handlerSubscribeCollection follows every feed of a collection. With
+// track_additions, feeds added to the collection later are followed too.
+// Subscribing again only changes track_additions and follows the feeds added
+// in the meantime.
+func (apiConfig *apiConfig) handlerSubscribeCollection(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		TrackAdditions bool `json:"track_additions"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	collection, ok := apiConfig.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Println("Error starting transaction: ", fmt.Errorf("error starting transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error subscribing to collection")
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiConfig.DB.WithTx(tx)
+
+	subscription, err := qtx.UpsertCollectionSubscription(r.Context(), database.UpsertCollectionSubscriptionParams{
+		CollectionID:   collection.ID,
+		UserID:         user.ID,
+		TrackAdditions: params.TrackAdditions,
+	})
+	if err != nil {
+		log.Println("Error subscribing to collection: ", fmt.Errorf("error subscribing to collection: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error subscribing to collection")
+		return
+	}
+
+	followed, err := qtx.FollowCollectionFeeds(r.Context(), database.FollowCollectionFeedsParams{
+		UserID:       user.ID,
+		CollectionID: collection.ID,
+	})
+	if err != nil {
+		log.Println("Error following collection feeds: ", fmt.Errorf("error following collection feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error subscribing to collection")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction: ", fmt.Errorf("error committing transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error subscribing to collection")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, CollectionSubscription{
+		CollectionID:   subscription.CollectionID,
+		TrackAdditions: subscription.TrackAdditions,
+		FollowedFeeds:  followed,
+		CreatedAt:      subscription.CreatedAt.Time,
+		UpdatedAt:      subscription.UpdatedAt.Time,
+	})
+}
+
+// handlerUnsubscribeCollection stops tracking a collection. The feeds it
+// followed stay followed.
+func (apiConfig *apiConfig) handlerUnsubscribeCollection(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	collection, ok := apiConfig.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteCollectionSubscription(r.Context(), database.DeleteCollectionSubscriptionParams{
+		CollectionID: collection.ID,
+		UserID:       user.ID,
+	})
+	if err != nil {
+		log.Println("Error unsubscribing from collection: ", fmt.Errorf("error unsubscribing from collection: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error unsubscribing from collection")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "not subscribed to this collection")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// missingFeed returns the first of ids that is not among feeds.
+func missingFeed(feeds []database.Feed, ids []uuid.UUID) (uuid.UUID, bool) {
+	found := map[uuid.UUID]bool{}
+	for _, feed := range feeds {
+		found[feed.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return id, true
+		}
+	}
+	return uuid.Nil, false
+}
+
+// collectionFromRequest loads the collection named by the slug URL
+// parameter, writing the error response when there is none.
+func (apiConfig *apiConfig) collectionFromRequest(w http.ResponseWriter, r *http.Request) (database.Collection, bool) {
+	collection, err := apiConfig.DB.GetCollectionBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "collection not found")
+		return database.Collection{}, false
+	}
+	if err != nil {
+		log.Println("Error getting collection: ", fmt.Errorf("error getting collection: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting collection")
+		return database.Collection{}, false
+	}
+	return collection, true
+}
+
+// ownedCollectionFromRequest is collectionFromRequest for the changes only
+// the collection's owner may make.
+func (apiConfig *apiConfig) ownedCollectionFromRequest(w http.ResponseWriter, r *http.Request) (database.Collection, bool) {
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return database.Collection{}, false
+	}
+
+	collection, ok := apiConfig.collectionFromRequest(w, r)
+	if !ok {
+		return collection, false
+	}
+	if collection.UserID != user.ID {
+		responseWithError(w, http.StatusForbidden, "only the owner of the collection can change it")
+		return collection, false
+	}
+	return collection, true
+}
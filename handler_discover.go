@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func (apiConfig *apiConfig) handlerDiscoverFeeds(w http.ResponseWriter, r *http.Request) {
+
+	pageURL := r.URL.Query().Get("url")
+	if pageURL == "" {
+		responseWithError(w, http.StatusBadRequest, "missing url query parameter")
+		return
+	}
+
+	if validationErr := validateFeedURL(pageURL); validationErr != nil {
+		responseWithJSON(w, http.StatusUnprocessableEntity, validationErr)
+		return
+	}
+
+	candidates, err := discoverFeeds(r.Context(), apiConfig.Fetcher, pageURL)
+	if errors.Is(err, errNonPublicAddress) {
+		responseWithJSON(w, http.StatusUnprocessableEntity, feedErrorFrom(pageURL, err))
+		return
+	}
+	if errors.Is(err, errNoFeedFound) {
+		responseWithError(w, http.StatusNotFound, "no feed found at url")
+		return
+	}
+	if err != nil {
+		log.Println("Error discovering feeds: ", fmt.Errorf("error discovering feeds: %w", err))
+		responseWithError(w, http.StatusBadGateway, "could not fetch url")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, candidates)
+}
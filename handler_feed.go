@@ -1,20 +1,38 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// feedRefreshCooldown is how long after a fetch a feed can be refreshed on
+// demand again.
+const feedRefreshCooldown = time.Minute
+
 func (apiConfig *apiConfig) handlerCreateFeed(w http.ResponseWriter, r *http.Request) {
 
 	type parameters struct {
 		Title string `json:"title"` 
 		Url   string `json:"url"`
+		FullContent bool `json:"full_content"`
+		// SkipValidation stores the feed without fetching it, for feeds that
+		// are temporarily down
+		SkipValidation bool `json:"skip_validation"`
+		// Follow subscribes the user to the feed, defaults to true
+		Follow *bool `json:"follow"`
 	}
 
 	user, err := getUserFromContext(r)
@@ -30,36 +48,416 @@ func (apiConfig *apiConfig) handlerCreateFeed(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	createdFeed, err := apiConfig.DB.CreateFeed(r.Context(), database.CreateFeedParams{
+	if validationErr := validateFeedURL(params.Url); validationErr != nil {
+		responseWithJSON(w, http.StatusUnprocessableEntity, validationErr)
+		return
+	}
+
+	follow := params.Follow == nil || *params.Follow
+
+	// The feed may already have been added by someone else, in which case it
+	// is simply followed
+	feedUrl, title := params.Url, params.Title
+	_, err = apiConfig.DB.GetFeedByURL(r.Context(), feedUrl)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("Error getting feed: ", fmt.Errorf("error getting feed: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating feed")
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) && !params.SkipValidation {
+		// Users often paste the website address instead of the feed's, store the
+		// feed the website advertises so the scraper can actually read it
+		candidate, rssFeed, validationErr := testFetchFeed(r.Context(), apiConfig.Fetcher, params.Url)
+		if validationErr != nil {
+			log.Println("Error validating feed: ", validationErr)
+			responseWithJSON(w, http.StatusUnprocessableEntity, validationErr)
+			return
+		}
+
+		feedUrl = candidate.URL
+		if title == "" {
+			title = rssFeed.Channel.Title
+		}
+	}
+
+	// New feeds stored without being fetched, or whose channel has no title,
+	// are named after their URL
+	if errors.Is(err, sql.ErrNoRows) && strings.TrimSpace(title) == "" {
+		title = feedUrl
+	}
+
+	createdFeed, err := apiConfig.createFeed(r.Context(), user.ID, database.CreateFeedParams{
 		ID:     uuid.New(),
-		Title:  params.Title,
-		Url:    params.Url,
+		Title:  title,
+		Url:    feedUrl,
 		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
-	})
+		FetchFullContent: params.FullContent,
+	}, follow)
 
 	if err != nil {
 
 		log.Println("Error creating feed: ",  fmt.Errorf("error creating feed: %w", err))
-		responseWithError(w, http.StatusInternalServerError, "error creating feed: ")
+		responseWithError(w, http.StatusInternalServerError, "error creating feed")
 		return
 	}
 
-	responseWithJSON(w, http.StatusOK, databaseToFeed(createdFeed))
+	responseWithJSON(w, http.StatusOK, createdFeed)
+}
+
+// createFeed stores a feed and, when follow is set, subscribes the user to it
+// in the same transaction. A feed with the same URL that already exists is
+// reused rather than reported as a conflict, the requested title then becomes
+// the user's own title for it.
+func (apiConfig *apiConfig) createFeed(ctx context.Context, userID uuid.UUID, params database.CreateFeedParams, follow bool) (CreatedFeed, error) {
+	tx, err := apiConfig.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return CreatedFeed{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := apiConfig.DB.WithTx(tx)
+
+	existing := false
+	feed, err := qtx.CreateFeed(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		existing = true
+		feed, err = qtx.GetFeedByURL(ctx, params.Url)
+	}
+	if err != nil {
+		return CreatedFeed{}, err
+	}
+
+	result := CreatedFeed{Feed: databaseToFeed(feed), Existing: existing}
+
+	if follow {
+		title := sql.NullString{}
+		if existing && params.Title != "" && params.Title != feed.Title {
+			title = sql.NullString{String: params.Title, Valid: true}
+		}
+
+		feedFollow, err := qtx.UpsertFeedFollows(ctx, database.UpsertFeedFollowsParams{
+			ID:     uuid.New(),
+			FeedID: uuid.NullUUID{UUID: feed.ID, Valid: true},
+			UserID: uuid.NullUUID{UUID: userID, Valid: true},
+			Title:  title,
+		})
+		if err != nil {
+			return CreatedFeed{}, err
+		}
+
+		mappedFeedFollow := databaseToFeedFollows(feedFollow)
+		result.FeedFollow = &mappedFeedFollow
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CreatedFeed{}, err
+	}
+	return result, nil
 }
 
 func (apiConfig *apiConfig) handlerGetFeeds(w http.ResponseWriter, r *http.Request) {
 	
-	feeds, err := apiConfig.DB.GetFeeds(r.Context())
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var feeds []database.Feed
+	if page.After != nil {
+		feeds, err = apiConfig.DB.GetFeedsAfter(r.Context(), database.GetFeedsAfterParams{
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+	} else {
+		feeds, err = apiConfig.DB.GetFeeds(r.Context(), database.GetFeedsParams{
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
 	if err != nil {
 		log.Println("Error listing feeds: ", fmt.Errorf("error listing feeds: %w", err))
 		responseWithError(w, http.StatusInternalServerError, "error listing feeds")
 		return
 	}
 
+	feeds = paginate(w, r, page, feeds, func(feed database.Feed) pageCursor {
+		return pageCursor{Time: feed.CreatedAt.Time, ID: feed.ID}
+	})
+
 
 	mappedFeeds := databaseFeedsToFeeds(feeds)
 
 	responseWithJSON(w, http.StatusOK, mappedFeeds)
 }
 
+// feedFromRequest loads the feed identified by the feedId URL parameter,
+// writing the error response and returning false when it can't.
+func (apiConfig *apiConfig) feedFromRequest(w http.ResponseWriter, r *http.Request) (database.Feed, bool) {
+	feedIdUuid, err := uuid.Parse(chi.URLParam(r, "feedId"))
+	if err != nil {
+		log.Println("Error parsing feed ID: ", fmt.Errorf("error parsing feed ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid feed ID")
+		return database.Feed{}, false
+	}
+
+	feed, err := apiConfig.DB.GetFeed(r.Context(), feedIdUuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "feed not found")
+		return database.Feed{}, false
+	}
+	if err != nil {
+		log.Println("Error getting feed: ", fmt.Errorf("error getting feed: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting feed")
+		return database.Feed{}, false
+	}
+
+	return feed, true
+}
+
+func (apiConfig *apiConfig) handlerGetFeed(w http.ResponseWriter, r *http.Request) {
+
+	feed, ok := apiConfig.feedFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToFeed(feed))
+}
+
+func (apiConfig *apiConfig) handlerUpdateFeed(w http.ResponseWriter, r *http.Request) {
+
+	// Fields left out of the payload are not changed
+	type parameters struct {
+		Title               *string `json:"title"`
+		Url                 *string `json:"url"`
+		FullContent         *bool   `json:"full_content"`
+		Enabled             *bool   `json:"enabled"`
+		// PollIntervalMinutes sets how often the feed is fetched, 0 restores
+		// the scraper's default interval
+		PollIntervalMinutes *int32  `json:"poll_interval_minutes"`
+		SkipValidation      bool    `json:"skip_validation"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	feed, ok := apiConfig.feedFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !feed.UserID.Valid || feed.UserID.UUID != user.ID {
+		responseWithError(w, http.StatusForbidden, "only the user who added the feed can change it")
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	update := database.UpdateFeedParams{
+		ID:                  feed.ID,
+		Title:               feed.Title,
+		Url:                 feed.Url,
+		FetchFullContent:    feed.FetchFullContent,
+		Enabled:             feed.Enabled,
+		PollIntervalMinutes: feed.PollIntervalMinutes,
+	}
 
+	// Other users get the feed's posts too, what they receive can't change
+	// under them
+	changesTitle := params.Title != nil && *params.Title != feed.Title
+	changesURL := params.Url != nil && *params.Url != feed.Url
+	changesEnabled := params.Enabled != nil && *params.Enabled != feed.Enabled
+	if changesTitle || changesURL || changesEnabled {
+		shared, err := apiConfig.DB.FeedHasOtherUsers(r.Context(), database.FeedHasOtherUsersParams{
+			FeedID: feed.ID,
+			UserID: user.ID,
+		})
+		if err != nil {
+			log.Println("Error checking feed users: ", fmt.Errorf("error checking feed users: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error updating feed")
+			return
+		}
+		if shared {
+			responseWithError(w, http.StatusConflict, "the feed is followed by other users, its title, url and enabled can't be changed: rename your feed follow instead")
+			return
+		}
+	}
+
+	if params.Title != nil {
+		update.Title = *params.Title
+	}
+	if params.FullContent != nil {
+		update.FetchFullContent = *params.FullContent
+	}
+	if params.Enabled != nil {
+		update.Enabled = *params.Enabled
+	}
+	if params.PollIntervalMinutes != nil {
+		if *params.PollIntervalMinutes < 0 {
+			responseWithError(w, http.StatusBadRequest, "poll_interval_minutes must not be negative")
+			return
+		}
+		update.PollIntervalMinutes = sql.NullInt32{Int32: *params.PollIntervalMinutes, Valid: *params.PollIntervalMinutes > 0}
+	}
+
+	if params.Url != nil && *params.Url != feed.Url {
+		if validationErr := validateFeedURL(*params.Url); validationErr != nil {
+			responseWithJSON(w, http.StatusUnprocessableEntity, validationErr)
+			return
+		}
+
+		update.Url = *params.Url
+		if !params.SkipValidation {
+			candidate, _, validationErr := testFetchFeed(r.Context(), apiConfig.Fetcher, *params.Url)
+			if validationErr != nil {
+				log.Println("Error validating feed: ", validationErr)
+				responseWithJSON(w, http.StatusUnprocessableEntity, validationErr)
+				return
+			}
+			update.Url = candidate.URL
+		}
+	}
+
+	updatedFeed, err := apiConfig.DB.UpdateFeed(r.Context(), update)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		responseWithError(w, http.StatusConflict, "another feed already uses this url")
+		return
+	}
+	if err != nil {
+		log.Println("Error updating feed: ", fmt.Errorf("error updating feed: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating feed")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToFeed(updatedFeed))
+}
+
+func (apiConfig *apiConfig) handlerDeleteFeed(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	feed, ok := apiConfig.feedFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !feed.UserID.Valid || feed.UserID.UUID != user.ID {
+		responseWithError(w, http.StatusForbidden, "only the user who added the feed can delete it")
+		return
+	}
+
+	shared, err := apiConfig.DB.FeedHasOtherUsers(r.Context(), database.FeedHasOtherUsersParams{
+		FeedID: feed.ID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		log.Println("Error checking feed users: ", fmt.Errorf("error checking feed users: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting feed")
+		return
+	}
+
+	// Deleting the feed would take the posts, read state and tags of the other
+	// users with it, only the caller's follow goes
+	if shared {
+		if _, err := apiConfig.DB.DeleteFeedFollowsByFeed(r.Context(), database.DeleteFeedFollowsByFeedParams{
+			FeedID: uuid.NullUUID{UUID: feed.ID, Valid: true},
+			UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		}); err != nil {
+			log.Println("Error deleting feed follows: ", fmt.Errorf("error deleting feed follows: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error deleting feed")
+			return
+		}
+
+		responseWithJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteFeed(r.Context(), database.DeleteFeedParams{
+		ID:     feed.ID,
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	if err != nil {
+		log.Println("Error deleting feed: ", fmt.Errorf("error deleting feed: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting feed")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (apiConfig *apiConfig) handlerRefreshFeed(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	feed, ok := apiConfig.feedFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Anyone following the feed may refresh it, not just the user who added it
+	if !feed.UserID.Valid || feed.UserID.UUID != user.ID {
+		following, err := apiConfig.DB.IsFollowingFeed(r.Context(), database.IsFollowingFeedParams{
+			UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+			FeedID: uuid.NullUUID{UUID: feed.ID, Valid: true},
+		})
+		if err != nil {
+			log.Println("Error checking feed follows: ", fmt.Errorf("error checking feed follows: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error refreshing feed")
+			return
+		}
+		if !following {
+			responseWithError(w, http.StatusForbidden, "only users following the feed can refresh it")
+			return
+		}
+	}
+
+	if !feed.Enabled {
+		responseWithError(w, http.StatusConflict, "the feed is disabled")
+		return
+	}
+
+	// Refreshes are spaced out, every follower can ask for one and each
+	// fetches the publisher's site
+	claimed, err := apiConfig.DB.ClaimFeedRefresh(r.Context(), database.ClaimFeedRefreshParams{
+		ID:            feed.ID,
+		FetchedBefore: time.Now().Add(-feedRefreshCooldown),
+	})
+	if err != nil {
+		log.Println("Error claiming feed refresh: ", fmt.Errorf("error claiming feed refresh: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error refreshing feed")
+		return
+	}
+	if claimed == 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(feedRefreshCooldown.Seconds())))
+		responseWithError(w, http.StatusTooManyRequests, "the feed was fetched less than a minute ago")
+		return
+	}
+
+	result := apiConfig.Scraper.refreshFeed(r.Context(), feed)
+
+	responseWithJSON(w, http.StatusOK, result)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,6 +17,8 @@ func (apiConfig *apiConfig) handlerCreateFeedFollows(w http.ResponseWriter, r *h
 
 	type parameters struct {
 		FeedId uuid.UUID `json:"feed_id"` 
+		// Title overrides the feed title for this user only
+		Title string `json:"title"`
 	}
 
 	user, err := getUserFromContext(r)
@@ -34,6 +38,7 @@ func (apiConfig *apiConfig) handlerCreateFeedFollows(w http.ResponseWriter, r *h
 		ID:     uuid.New(),
 		FeedID: uuid.NullUUID{UUID: params.FeedId, Valid: true},
 		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Title:  sql.NullString{String: params.Title, Valid: params.Title != ""},
 	})
 
 	if err != nil {
@@ -56,17 +61,111 @@ func (apiConfig *apiConfig) handlerGetFeedFollows(w http.ResponseWriter, r *http
 	}
 
 
-	feedFollows, err := apiConfig.DB.GetFeedFollows(r.Context(), uuid.NullUUID{UUID: user.ID, Valid: true})
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var feedFollows []database.FeedFollow
+	if page.After != nil {
+		feedFollows, err = apiConfig.DB.GetFeedFollowsAfter(r.Context(), database.GetFeedFollowsAfterParams{
+			UserID:    uuid.NullUUID{UUID: user.ID, Valid: true},
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+	} else {
+		feedFollows, err = apiConfig.DB.GetFeedFollows(r.Context(), database.GetFeedFollowsParams{
+			UserID:     uuid.NullUUID{UUID: user.ID, Valid: true},
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
 	if err != nil {
 		log.Println("Error listing feed follows: ", fmt.Errorf("error listing feed follows: %w", err))
 		responseWithError(w, http.StatusInternalServerError, "error listing feed follows")
 		return
 	}
+
+	feedFollows = paginate(w, r, page, feedFollows, func(feedFollow database.FeedFollow) pageCursor {
+		return pageCursor{Time: feedFollow.CreatedAt.Time, ID: feedFollow.ID}
+	})
 	mappedFeedFollows := databaseFeedFollowsToFeedFollows(feedFollows)
 
+	feedIDs := make([]uuid.UUID, 0, len(feedFollows))
+	for _, feedFollow := range feedFollows {
+		feedIDs = append(feedIDs, feedFollow.FeedID.UUID)
+	}
+	unreadCounts, err := apiConfig.DB.CountUnreadPostsByFeed(r.Context(), database.CountUnreadPostsByFeedParams{
+		UserID:  user.ID,
+		FeedIds: feedIDs,
+	})
+	if err != nil {
+		log.Println("Error counting unread posts: ", fmt.Errorf("error counting unread posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing feed follows")
+		return
+	}
+
+	unread := map[uuid.UUID]int64{}
+	for _, count := range unreadCounts {
+		unread[count.FeedID.UUID] = count.UnreadCount
+	}
+	for i := range mappedFeedFollows {
+		count := unread[mappedFeedFollows[i].FeedID.UUID]
+		mappedFeedFollows[i].UnreadCount = &count
+	}
+
 	responseWithJSON(w, http.StatusOK, mappedFeedFollows)
 }
 
+func (apiConfig *apiConfig) handlerUpdateFeedFollows(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		// Title overrides the feed title for this user, an empty title
+		// restores the feed's own
+		Title string `json:"title"`
+	}
+
+	feedFollowIdUuid, err := uuid.Parse(chi.URLParam(r, "feedFollowId"))
+	if err != nil {
+		log.Println("Error parsing feed follow ID: ", fmt.Errorf("error parsing feed follow ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid feed follow ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	updatedFeedFollows, err := apiConfig.DB.UpdateFeedFollowTitle(r.Context(), database.UpdateFeedFollowTitleParams{
+		ID:     feedFollowIdUuid,
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Title:  sql.NullString{String: params.Title, Valid: params.Title != ""},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "feed follow not found")
+		return
+	}
+	if err != nil {
+		log.Println("Error updating feed follows: ", fmt.Errorf("error updating feed follows: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating feed follows")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToFeedFollows(updatedFeedFollows))
+}
+
 func (apiConfig *apiConfig) handlerDeleteFeedFollows(w http.ResponseWriter, r *http.Request) {
 
 	feedFollowIdString := chi.URLParam(r, "feedFollowId")
@@ -84,10 +183,40 @@ func (apiConfig *apiConfig) handlerDeleteFeedFollows(w http.ResponseWriter, r *h
 		return
 	}
 
-	// TODO: Check if the feed follow exists before attempting to delete it
+	deleted, err := apiConfig.DB.DeleteFeedFollows(r.Context(), database.DeleteFeedFollowsParams{
+		ID:     feedFollowIdUuid,
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	if err != nil {
+		log.Println("Error deleting feed follows: ", fmt.Errorf("error deleting feed follows: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting feed follows")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "feed follow not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (apiConfig *apiConfig) handlerUnfollowFeed(w http.ResponseWriter, r *http.Request) {
+
+	feedIdUuid, err := uuid.Parse(chi.URLParam(r, "feedId"))
+	if err != nil {
+		log.Println("Error parsing feed ID: ", fmt.Errorf("error parsing feed ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid feed ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
 
-	err = apiConfig.DB.DeleteFeedFollows(r.Context(), database.DeleteFeedFollowsParams{
-		FeedID: uuid.NullUUID{UUID: feedFollowIdUuid, Valid: true},
+	deleted, err := apiConfig.DB.DeleteFeedFollowsByFeed(r.Context(), database.DeleteFeedFollowsByFeedParams{
+		FeedID: uuid.NullUUID{UUID: feedIdUuid, Valid: true},
 		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
 	})
 	if err != nil {
@@ -95,6 +224,68 @@ func (apiConfig *apiConfig) handlerDeleteFeedFollows(w http.ResponseWriter, r *h
 		responseWithError(w, http.StatusInternalServerError, "error deleting feed follows")
 		return
 	}
-	
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "not following this feed")
+		return
+	}
+
 	responseWithJSON(w, http.StatusOK, struct{}{})
-}
\ No newline at end of file
+}
+
+func (apiConfig *apiConfig) handlerBulkDeleteFeedFollows(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+
+	type response struct {
+		Deleted  []uuid.UUID `json:"deleted"`
+		NotFound []uuid.UUID `json:"not_found"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if len(params.IDs) == 0 {
+		responseWithError(w, http.StatusBadRequest, "ids must not be empty")
+		return
+	}
+
+	deletedIds, err := apiConfig.DB.DeleteFeedFollowsBulk(r.Context(), database.DeleteFeedFollowsBulkParams{
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Ids:    params.IDs,
+	})
+	if err != nil {
+		log.Println("Error deleting feed follows: ", fmt.Errorf("error deleting feed follows: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting feed follows")
+		return
+	}
+	if len(deletedIds) == 0 {
+		responseWithError(w, http.StatusNotFound, "no feed follows found")
+		return
+	}
+
+	deleted := map[uuid.UUID]bool{}
+	for _, id := range deletedIds {
+		deleted[id] = true
+	}
+
+	result := response{Deleted: deletedIds, NotFound: []uuid.UUID{}}
+	for _, id := range params.IDs {
+		if !deleted[id] {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+
+	responseWithJSON(w, http.StatusOK, result)
+}
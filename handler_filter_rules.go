@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDryRunPosts = 200
+	maxDryRunPosts     = 1000
+)
+
+// filterRuleParameters is the payload creating a rule, and the rule tried by
+// the dry run.
+type filterRuleParameters struct {
+	Name string `json:"name"`
+	// FeedFollowID scopes the rule to one follow, it applies to every follow
+	// when left out
+	FeedFollowID uuid.NullUUID `json:"feed_follow_id"`
+	// Field defaults to any
+	Field string `json:"field"`
+	// Keywords or Regex, not both
+	Keywords []string `json:"keywords"`
+	Regex    *string  `json:"regex"`
+	Action   string   `json:"action"`
+	// Tag is the tag name of the tag action
+	Tag string `json:"tag"`
+}
+
+// filterRuleFromRequest decodes and validates a rule, writing the error
+// response when it is invalid.
+func (apiConfig *apiConfig) filterRuleFromRequest(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.FilterRule, bool) {
+	var params filterRuleParameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return database.FilterRule{}, false
+	}
+
+	rule := database.FilterRule{
+		ID:           uuid.New(),
+		UserID:       userID,
+		FeedFollowID: params.FeedFollowID,
+		Name:         strings.TrimSpace(params.Name),
+		Field:        params.Field,
+		Keywords:     []string{},
+		Action:       params.Action,
+	}
+
+	if rule.Field == "" {
+		rule.Field = ruleFieldAny
+	}
+	if !ruleFields[rule.Field] {
+		responseWithError(w, http.StatusBadRequest, "field must be title, content, author, category or any")
+		return rule, false
+	}
+
+	for _, keyword := range params.Keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			rule.Keywords = append(rule.Keywords, keyword)
+		}
+	}
+	if params.Regex != nil {
+		rule.Regex = sql.NullString{String: *params.Regex, Valid: true}
+	}
+	if len(rule.Keywords) > 0 && rule.Regex.Valid {
+		responseWithError(w, http.StatusBadRequest, "keywords and regex can't be used together")
+		return rule, false
+	}
+	if len(rule.Keywords) == 0 && (!rule.Regex.Valid || rule.Regex.String == "") {
+		responseWithError(w, http.StatusBadRequest, "keywords or regex is required")
+		return rule, false
+	}
+	if _, err := compileFilterRule(rule); err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return rule, false
+	}
+
+	if !ruleActions[rule.Action] {
+		responseWithError(w, http.StatusBadRequest, "action must be hide, mark_read, star or tag")
+		return rule, false
+	}
+	if rule.Action == ruleActionTag {
+		names, err := parseTagNames([]string{params.Tag})
+		if err != nil {
+			responseWithError(w, http.StatusBadRequest, err.Error())
+			return rule, false
+		}
+		if len(names) != 1 {
+			responseWithError(w, http.StatusBadRequest, "tag must be a single tag name")
+			return rule, false
+		}
+		rule.Tag = sql.NullString{String: names[0], Valid: true}
+	}
+
+	if rule.FeedFollowID.Valid {
+		_, err := apiConfig.DB.GetFeedFollow(r.Context(), database.GetFeedFollowParams{
+			ID:     rule.FeedFollowID.UUID,
+			UserID: uuid.NullUUID{UUID: userID, Valid: true},
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			responseWithError(w, http.StatusNotFound, "feed follow not found")
+			return rule, false
+		}
+		if err != nil {
+			log.Println("Error getting feed follow: ", fmt.Errorf("error getting feed follow: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error getting feed follow")
+			return rule, false
+		}
+	}
+
+	return rule, true
+}
+
+// handlerCreateFilterRule adds a rule run against the new posts of followed
+// feeds. Posts stored before are left alone.
+func (apiConfig *apiConfig) handlerCreateFilterRule(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	rule, ok := apiConfig.filterRuleFromRequest(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	createdRule, err := apiConfig.DB.CreateFilterRule(r.Context(), database.CreateFilterRuleParams{
+		ID:           rule.ID,
+		UserID:       rule.UserID,
+		FeedFollowID: rule.FeedFollowID,
+		Name:         rule.Name,
+		Field:        rule.Field,
+		Keywords:     rule.Keywords,
+		Regex:        rule.Regex,
+		Action:       rule.Action,
+		Tag:          rule.Tag,
+	})
+	if err != nil {
+		log.Println("Error creating filter rule: ", fmt.Errorf("error creating filter rule: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating filter rule")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToFilterRule(createdRule))
+}
+
+func (apiConfig *apiConfig) handlerGetFilterRules(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var dbRules []database.FilterRule
+	if page.After != nil {
+		dbRules, err = apiConfig.DB.GetFilterRulesAfter(r.Context(), database.GetFilterRulesAfterParams{
+			UserID:    user.ID,
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+	} else {
+		dbRules, err = apiConfig.DB.GetFilterRules(r.Context(), database.GetFilterRulesParams{
+			UserID:     user.ID,
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Println("Error listing filter rules: ", fmt.Errorf("error listing filter rules: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing filter rules")
+		return
+	}
+
+	dbRules = paginate(w, r, page, dbRules, func(dbRule database.FilterRule) pageCursor {
+		return pageCursor{Time: dbRule.CreatedAt.Time, ID: dbRule.ID}
+	})
+
+	rules := make([]FilterRule, len(dbRules))
+	for i, dbRule := range dbRules {
+		rules[i] = databaseToFilterRule(dbRule)
+	}
+
+	responseWithJSON(w, http.StatusOK, rules)
+}
+
+func (apiConfig *apiConfig) handlerDeleteFilterRule(w http.ResponseWriter, r *http.Request) {
+
+	ruleIdUuid, err := uuid.Parse(chi.URLParam(r, "ruleId"))
+	if err != nil {
+		log.Println("Error parsing rule ID: ", fmt.Errorf("error parsing rule ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid rule ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteFilterRule(r.Context(), database.DeleteFilterRuleParams{
+		ID:     ruleIdUuid,
+		UserID: user.ID,
+	})
+	if err != nil {
+		log.Println("Error deleting filter rule: ", fmt.Errorf("error deleting filter rule: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting filter rule")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "filter rule not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerDryRunFilterRule evaluates a rule, without saving it, against the
+// latest posts of the feeds it applies to and returns the ones it matches.
+// Nothing is done to them.
+func (apiConfig *apiConfig) handlerDryRunFilterRule(w http.ResponseWriter, r *http.Request) {
+
+	type response struct {
+		Scanned int    `json:"scanned"`
+		Matched []Post `json:"matched"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	limit := defaultDryRunPosts
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxDryRunPosts {
+			responseWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxDryRunPosts))
+			return
+		}
+	}
+
+	dbRule, ok := apiConfig.filterRuleFromRequest(w, r, user.ID)
+	if !ok {
+		return
+	}
+	rule, err := compileFilterRule(dbRule)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, err := apiConfig.DB.GetRecentFollowedPosts(r.Context(), database.GetRecentFollowedPostsParams{
+		UserID:       uuid.NullUUID{UUID: user.ID, Valid: true},
+		FeedFollowID: rule.FeedFollowID,
+		RowLimit:     int32(limit),
+	})
+	if err != nil {
+		log.Println("Error getting recent posts: ", fmt.Errorf("error getting recent posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error running filter rule")
+		return
+	}
+
+	matched := []database.Post{}
+	for _, post := range posts {
+		if rule.matches(post) {
+			matched = append(matched, post)
+		}
+	}
+
+	responseWithJSON(w, http.StatusOK, response{
+		Scanned: len(posts),
+		Matched: databasePostsToPosts(matched),
+	})
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func (apiConfig *apiConfig) handlerCreateFolder(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Name     string     `json:"name"`
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		responseWithError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	parentID := uuid.NullUUID{}
+	if params.ParentID != nil {
+		parentID = uuid.NullUUID{UUID: *params.ParentID, Valid: true}
+		if status, message := apiConfig.checkFolderParent(r.Context(), user.ID, uuid.Nil, *params.ParentID); status != 0 {
+			responseWithError(w, status, message)
+			return
+		}
+	}
+
+	folder, err := apiConfig.DB.CreateFolder(r.Context(), database.CreateFolderParams{
+		ID:       uuid.New(),
+		UserID:   user.ID,
+		ParentID: parentID,
+		Name:     params.Name,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		responseWithError(w, http.StatusConflict, "a folder with this name already exists")
+		return
+	}
+	if err != nil {
+		log.Println("Error creating folder: ", fmt.Errorf("error creating folder: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating folder")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToFolder(folder))
+}
+
+// handlerGetFolders returns the folder tree along with the followed feeds
+// in each folder and the ones in none.
+func (apiConfig *apiConfig) handlerGetFolders(w http.ResponseWriter, r *http.Request) {
+
+	type response struct {
+		Folders     []FolderNode `json:"folders"`
+		Unfiled     []FolderFeed `json:"unfiled"`
+		UnreadCount int64        `json:"unread_count"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	folders, err := apiConfig.DB.GetFolders(r.Context(), user.ID)
+	if err != nil {
+		log.Println("Error listing folders: ", fmt.Errorf("error listing folders: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing folders")
+		return
+	}
+
+	feeds, err := apiConfig.DB.GetFolderTreeFeeds(r.Context(), uuid.NullUUID{UUID: user.ID, Valid: true})
+	if err != nil {
+		log.Println("Error listing folder feeds: ", fmt.Errorf("error listing folder feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing folders")
+		return
+	}
+
+	result := response{Folders: []FolderNode{}, Unfiled: []FolderFeed{}}
+
+	feedsByFolder := map[uuid.UUID][]FolderFeed{}
+	for _, feed := range feeds {
+		folderFeed := FolderFeed{
+			FeedFollowID: feed.ID,
+			FeedID:       feed.FeedID,
+			Title:        feed.Title,
+			UnreadCount:  feed.UnreadCount,
+		}
+		result.UnreadCount += feed.UnreadCount
+		if feed.FolderID.Valid {
+			feedsByFolder[feed.FolderID.UUID] = append(feedsByFolder[feed.FolderID.UUID], folderFeed)
+		} else {
+			result.Unfiled = append(result.Unfiled, folderFeed)
+		}
+	}
+
+	node := func(folder database.Folder) FolderNode {
+		n := FolderNode{Folder: databaseToFolder(folder), Feeds: feedsByFolder[folder.ID]}
+		if n.Feeds == nil {
+			n.Feeds = []FolderFeed{}
+		}
+		for _, feed := range n.Feeds {
+			n.UnreadCount += feed.UnreadCount
+		}
+		return n
+	}
+
+	topLevel := map[uuid.UUID]int{}
+	for _, folder := range folders {
+		if !folder.ParentID.Valid {
+			topLevel[folder.ID] = len(result.Folders)
+			result.Folders = append(result.Folders, node(folder))
+		}
+	}
+	for _, folder := range folders {
+		if !folder.ParentID.Valid {
+			continue
+		}
+		i, ok := topLevel[folder.ParentID.UUID]
+		if !ok {
+			continue
+		}
+		child := node(folder)
+		result.Folders[i].Children = append(result.Folders[i].Children, child)
+		result.Folders[i].UnreadCount += child.UnreadCount
+	}
+
+	responseWithJSON(w, http.StatusOK, result)
+}
+
+func (apiConfig *apiConfig) handlerUpdateFolder(w http.ResponseWriter, r *http.Request) {
+
+	// Fields left out of the payload are not changed, a null parent_id moves
+	// the folder to the top level
+	type parameters struct {
+		Name     *string         `json:"name"`
+		ParentID json.RawMessage `json:"parent_id"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	folder, ok := apiConfig.folderFromRequest(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	update := database.UpdateFolderParams{
+		ID:       folder.ID,
+		UserID:   user.ID,
+		Name:     folder.Name,
+		ParentID: folder.ParentID,
+	}
+
+	if params.Name != nil {
+		update.Name = strings.TrimSpace(*params.Name)
+		if update.Name == "" {
+			responseWithError(w, http.StatusBadRequest, "name must not be empty")
+			return
+		}
+	}
+
+	if len(params.ParentID) > 0 {
+		update.ParentID = uuid.NullUUID{}
+		if !bytes.Equal(params.ParentID, []byte("null")) {
+			var parentID uuid.UUID
+			if err := json.Unmarshal(params.ParentID, &parentID); err != nil {
+				responseWithError(w, http.StatusBadRequest, "invalid parent_id")
+				return
+			}
+			update.ParentID = uuid.NullUUID{UUID: parentID, Valid: true}
+		}
+	}
+
+	if update.ParentID.Valid && update.ParentID != folder.ParentID {
+		if status, message := apiConfig.checkFolderParent(r.Context(), user.ID, folder.ID, update.ParentID.UUID); status != 0 {
+			responseWithError(w, status, message)
+			return
+		}
+	}
+
+	updatedFolder, err := apiConfig.DB.UpdateFolder(r.Context(), update)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		responseWithError(w, http.StatusConflict, "a folder with this name already exists")
+		return
+	}
+	if err != nil {
+		log.Println("Error updating folder: ", fmt.Errorf("error updating folder: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating folder")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToFolder(updatedFolder))
+}
+
+// handlerDeleteFolder deletes a folder and its subfolders. The feeds they
+// held stay followed, outside of any folder.
+func (apiConfig *apiConfig) handlerDeleteFolder(w http.ResponseWriter, r *http.Request) {
+
+	folderIdUuid, err := uuid.Parse(chi.URLParam(r, "folderId"))
+	if err != nil {
+		log.Println("Error parsing folder ID: ", fmt.Errorf("error parsing folder ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid folder ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteFolder(r.Context(), database.DeleteFolderParams{
+		ID:     folderIdUuid,
+		UserID: user.ID,
+	})
+	if err != nil {
+		log.Println("Error deleting folder: ", fmt.Errorf("error deleting folder: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting folder")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "folder not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (apiConfig *apiConfig) handlerAddFolderFeedFollows(w http.ResponseWriter, r *http.Request) {
+	apiConfig.moveFolderFeedFollows(w, r, true)
+}
+
+func (apiConfig *apiConfig) handlerRemoveFolderFeedFollows(w http.ResponseWriter, r *http.Request) {
+	apiConfig.moveFolderFeedFollows(w, r, false)
+}
+
+// moveFolderFeedFollows puts feed follows in a folder, moving them out of the
+// one they were in, or takes them out of the folder.
+func (apiConfig *apiConfig) moveFolderFeedFollows(w http.ResponseWriter, r *http.Request, add bool) {
+
+	type parameters struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+
+	type response struct {
+		Updated  []uuid.UUID `json:"updated"`
+		NotFound []uuid.UUID `json:"not_found"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	folder, ok := apiConfig.folderFromRequest(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if len(params.IDs) == 0 {
+		responseWithError(w, http.StatusBadRequest, "ids must not be empty")
+		return
+	}
+
+	var updatedIds []uuid.UUID
+	if add {
+		updatedIds, err = apiConfig.DB.MoveFeedFollowsToFolder(r.Context(), database.MoveFeedFollowsToFolderParams{
+			UserID:   uuid.NullUUID{UUID: user.ID, Valid: true},
+			FolderID: uuid.NullUUID{UUID: folder.ID, Valid: true},
+			Ids:      params.IDs,
+		})
+	} else {
+		updatedIds, err = apiConfig.DB.RemoveFeedFollowsFromFolder(r.Context(), database.RemoveFeedFollowsFromFolderParams{
+			UserID:   uuid.NullUUID{UUID: user.ID, Valid: true},
+			FolderID: uuid.NullUUID{UUID: folder.ID, Valid: true},
+			Ids:      params.IDs,
+		})
+	}
+	if err != nil {
+		log.Println("Error moving feed follows: ", fmt.Errorf("error moving feed follows: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating feed follows")
+		return
+	}
+
+	updated := map[uuid.UUID]bool{}
+	for _, id := range updatedIds {
+		updated[id] = true
+	}
+
+	result := response{Updated: updatedIds, NotFound: []uuid.UUID{}}
+	if result.Updated == nil {
+		result.Updated = []uuid.UUID{}
+	}
+	for _, id := range params.IDs {
+		if !updated[id] {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+
+	responseWithJSON(w, http.StatusOK, result)
+}
+
+// folderFromRequest loads the user's folder named by the folderId URL
+// parameter, writing the error response when there is none.
+func (apiConfig *apiConfig) folderFromRequest(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Folder, bool) {
+	folderIdUuid, err := uuid.Parse(chi.URLParam(r, "folderId"))
+	if err != nil {
+		log.Println("Error parsing folder ID: ", fmt.Errorf("error parsing folder ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid folder ID")
+		return database.Folder{}, false
+	}
+
+	folder, err := apiConfig.DB.GetFolder(r.Context(), database.GetFolderParams{
+		ID:     folderIdUuid,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "folder not found")
+		return database.Folder{}, false
+	}
+	if err != nil {
+		log.Println("Error getting folder: ", fmt.Errorf("error getting folder: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting folder")
+		return database.Folder{}, false
+	}
+
+	return folder, true
+}
+
+// checkFolderParent makes sure a folder can be put inside parentID, folders
+// only nest one level deep. folderID is the folder being moved, uuid.Nil for
+// a new one. It returns the status and message of the error response, or a
+// zero status when the parent is fine.
+func (apiConfig *apiConfig) checkFolderParent(ctx context.Context, userID, folderID, parentID uuid.UUID) (int, string) {
+	if parentID == folderID {
+		return http.StatusBadRequest, "a folder can't be its own parent"
+	}
+
+	parent, err := apiConfig.DB.GetFolder(ctx, database.GetFolderParams{ID: parentID, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusBadRequest, "parent folder not found"
+	}
+	if err != nil {
+		log.Println("Error getting folder: ", fmt.Errorf("error getting folder: %w", err))
+		return http.StatusInternalServerError, "error getting folder"
+	}
+	if parent.ParentID.Valid {
+		return http.StatusBadRequest, "folders can only be nested one level deep"
+	}
+
+	if folderID != uuid.Nil {
+		hasChildren, err := apiConfig.DB.FolderHasChildren(ctx, uuid.NullUUID{UUID: folderID, Valid: true})
+		if err != nil {
+			log.Println("Error checking subfolders: ", fmt.Errorf("error checking subfolders: %w", err))
+			return http.StatusInternalServerError, "error getting folder"
+		}
+		if hasChildren {
+			return http.StatusBadRequest, "a folder with subfolders can't be put inside another folder"
+		}
+	}
+
+	return 0, ""
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// handlerImportOPML starts importing the feeds of an OPML file, sent as the
+// request body or as the file field of a multipart form. Checking every feed
+// takes a while so the import runs in the background, the response points at
+// the report to poll.
+func (apiConfig *apiConfig) handlerImportOPML(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLSize)
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			responseWithError(w, http.StatusBadRequest, "missing file field")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	doc, err := parseOPML(body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		responseWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("OPML files are limited to %d bytes", maxOPMLSize))
+		return
+	}
+	if err != nil {
+		log.Println("Error parsing OPML: ", fmt.Errorf("error parsing OPML: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid OPML document")
+		return
+	}
+
+	entries := doc.entries()
+	if len(entries) == 0 {
+		responseWithError(w, http.StatusBadRequest, "OPML document has no feeds")
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Println("Error starting transaction: ", fmt.Errorf("error starting transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error importing OPML")
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiConfig.DB.WithTx(tx)
+
+	opmlImport, err := qtx.CreateOPMLImport(r.Context(), database.CreateOPMLImportParams{
+		ID:     uuid.New(),
+		UserID: user.ID,
+	})
+	if err != nil {
+		log.Println("Error creating OPML import: ", fmt.Errorf("error creating OPML import: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error importing OPML")
+		return
+	}
+
+	items := make([]database.OpmlImportItem, len(entries))
+	for i, entry := range entries {
+		items[i], err = qtx.CreateOPMLImportItem(r.Context(), database.CreateOPMLImportItemParams{
+			ID:        uuid.New(),
+			ImportID:  opmlImport.ID,
+			Position:  int32(i),
+			Url:       entry.URL,
+			Title:     entry.Title,
+			Folder:    entry.Folder,
+			Subfolder: entry.Subfolder,
+		})
+		if err != nil {
+			log.Println("Error creating OPML import item: ", fmt.Errorf("error creating OPML import item: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error importing OPML")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction: ", fmt.Errorf("error committing transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error importing OPML")
+		return
+	}
+
+	go apiConfig.runOPMLImport(user.ID, opmlImport.ID, items)
+
+	w.Header().Set("Location", "/v1/opml/imports/"+opmlImport.ID.String())
+	responseWithJSON(w, http.StatusAccepted, databaseToOPMLImport(opmlImport, items))
+}
+
+// handlerExportOPML returns the user's follows as an OPML file, to back them
+// up or move them to another reader.
+func (apiConfig *apiConfig) handlerExportOPML(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	folders, err := apiConfig.DB.GetFolders(r.Context(), user.ID)
+	if err != nil {
+		log.Println("Error listing folders: ", fmt.Errorf("error listing folders: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error exporting OPML")
+		return
+	}
+
+	follows, err := apiConfig.DB.GetFeedFollowsWithFeeds(r.Context(), uuid.NullUUID{UUID: user.ID, Valid: true})
+	if err != nil {
+		log.Println("Error listing feed follows: ", fmt.Errorf("error listing feed follows: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error exporting OPML")
+		return
+	}
+
+	payload, err := xml.MarshalIndent(buildOPML(user.Name, time.Now(), folders, follows), "", "  ")
+	if err != nil {
+		log.Println("Error encoding OPML: ", fmt.Errorf("error encoding OPML: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error exporting OPML")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(payload)
+}
+
+func (apiConfig *apiConfig) handlerGetOPMLImport(w http.ResponseWriter, r *http.Request) {
+
+	importIdUuid, err := uuid.Parse(chi.URLParam(r, "importId"))
+	if err != nil {
+		log.Println("Error parsing import ID: ", fmt.Errorf("error parsing import ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid import ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	opmlImport, err := apiConfig.DB.GetOPMLImport(r.Context(), database.GetOPMLImportParams{
+		ID:     importIdUuid,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "import not found")
+		return
+	}
+	if err != nil {
+		log.Println("Error getting OPML import: ", fmt.Errorf("error getting OPML import: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting OPML import")
+		return
+	}
+
+	items, err := apiConfig.DB.GetOPMLImportItems(r.Context(), opmlImport.ID)
+	if err != nil {
+		log.Println("Error getting OPML import items: ", fmt.Errorf("error getting OPML import items: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting OPML import")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToOPMLImport(opmlImport, items))
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/darthvadr/rss-aggregator/internal/database"
 	"github.com/google/uuid"
@@ -18,11 +24,33 @@ func (apiConfig *apiConfig) handlerGetPostForUser(w http.ResponseWriter, r *http
 		return
 	}
 
-	posts, err := apiConfig.DB.GetPostsForUser(r.Context(), database.GetPostsForUserParams{
-		
-		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
-		Limit:  10,
-	})
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params, err := parseTimelineParams(r, user.ID, page)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// A folder that isn't the user's would only give an empty timeline
+	if params.FolderID.Valid {
+		_, err := apiConfig.DB.GetFolder(r.Context(), database.GetFolderParams{ID: params.FolderID.UUID, UserID: user.ID})
+		if errors.Is(err, sql.ErrNoRows) {
+			responseWithError(w, http.StatusNotFound, "folder not found")
+			return
+		}
+		if err != nil {
+			log.Println("Error getting folder: ", fmt.Errorf("error getting folder: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error getting posts")
+			return
+		}
+	}
+
+	posts, err := apiConfig.DB.ListTimeline(r.Context(), params)
 
 	if err != nil {
 
@@ -31,9 +59,175 @@ func (apiConfig *apiConfig) handlerGetPostForUser(w http.ResponseWriter, r *http
 		return
 	}
 
-	mappedPosts := databasePostsToPosts(posts)
+	posts = paginate(w, r, page, posts, func(post database.TimelinePost) pageCursor {
+		return pageCursor{Time: params.Sort.SortTime(post.Post), ID: post.ID}
+	})
+
+	mappedPosts := databaseTimelinePostsToPosts(posts)
+
+	// Each story is shown once, with the list of feeds it was published in
+	if params.Collapse {
+		mappedPosts, err = apiConfig.collapseStories(r.Context(), user.ID, mappedPosts)
+		if err != nil {
+			log.Println("Error collapsing posts: ", fmt.Errorf("error collapsing posts: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error getting posts")
+			return
+		}
+	}
+
+	// Clients that can't render HTML can ask for a plain-text copy of the content
+	if r.URL.Query().Get("include_text") == "true" {
+		for i := range mappedPosts {
+			mappedPosts[i].DescriptionText = htmlToText(mappedPosts[i].Description)
+		}
+	}
+
 	responseWithJSON(w, http.StatusOK, mappedPosts)
 }
 
+// parseTimelineParams reads the filters and sort order of the posts timeline:
+//
+//   - feed_id: one or more followed feed IDs, repeated or comma separated
+//   - folder: a folder ID, for the feeds in it and its subfolders
+//   - since, until: RFC 3339 bounds on the publication date
+//   - has_attachments: true or false
+//   - unread: true for the posts the user hasn't read, false for the read ones
+//   - starred: true for the posts the user starred, false for the others
+//   - hidden: true for the posts the user hid, false (default) for the others
+//   - tag: one or more tag names, repeated or comma separated
+//   - tag_mode: or (default) for posts with any of the tags, and for all
+//   - sort: published (default) or ingested
+//   - order: desc (default) or asc
+//   - collapse: true to show each story once
+func parseTimelineParams(r *http.Request, userID uuid.UUID, page pageParams) (database.ListTimelineParams, error) {
+	query := r.URL.Query()
+	params := database.ListTimelineParams{
+		UserID: userID,
+		Sort:   database.TimelineSortPublished,
+		Limit:  page.Limit + 1,
+	}
 
+	for _, value := range query["feed_id"] {
+		for _, id := range strings.Split(value, ",") {
+			feedID, err := uuid.Parse(strings.TrimSpace(id))
+			if err != nil {
+				return params, fmt.Errorf("invalid feed_id %q", id)
+			}
+			params.FeedIDs = append(params.FeedIDs, feedID)
+		}
+	}
 
+	if value := query.Get("folder"); value != "" {
+		folderID, err := uuid.Parse(value)
+		if err != nil {
+			return params, fmt.Errorf("invalid folder %q", value)
+		}
+		params.FolderID = uuid.NullUUID{UUID: folderID, Valid: true}
+	}
+
+	for name, bound := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return params, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*bound = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+
+	// Hidden posts are left out unless asked for
+	params.Hidden = sql.NullBool{Bool: false, Valid: true}
+
+	for name, filter := range map[string]*sql.NullBool{"has_attachments": &params.HasAttachments, "unread": &params.Unread, "starred": &params.Starred, "hidden": &params.Hidden} {
+		if value := query.Get(name); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return params, fmt.Errorf("%s must be true or false", name)
+			}
+			*filter = sql.NullBool{Bool: enabled, Valid: true}
+		}
+	}
+
+	var err error
+	if params.Tags, err = parseTagNames(query["tag"]); err != nil {
+		return params, err
+	}
+
+	switch query.Get("tag_mode") {
+	case "", "or":
+	case "and":
+		params.TagsMatchAll = true
+	default:
+		return params, errors.New("tag_mode must be and or or")
+	}
+
+	params.Collapse = query.Get("collapse") == "true"
+
+	switch query.Get("sort") {
+	case "", "published":
+	case "ingested":
+		params.Sort = database.TimelineSortIngested
+	default:
+		return params, errors.New("sort must be published or ingested")
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		params.Ascending = true
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
+
+	// before continues in list order, after walks back towards the start
+	if page.Before != nil {
+		params.Cursor = &database.TimelineCursor{Time: page.Before.Time, ID: page.Before.ID}
+	}
+	if page.After != nil {
+		params.Cursor = &database.TimelineCursor{Time: page.After.Time, ID: page.After.ID}
+		params.Reverse = true
+	}
+
+	return params, nil
+}
+
+// collapseStories attaches to the posts of a collapsed timeline, one per
+// story cluster, the feeds among the ones the user follows that published the
+// same story.
+func (apiConfig *apiConfig) collapseStories(ctx context.Context, userID uuid.UUID, posts []Post) ([]Post, error) {
+	collapsed := posts
+	clusterIDs := make([]uuid.UUID, 0, len(posts))
+	seen := map[uuid.UUID]int{}
+
+	for i, post := range posts {
+		clusterID := post.ID
+		if post.ClusterID.Valid {
+			clusterID = post.ClusterID.UUID
+		}
+		seen[clusterID] = i
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+
+	sources, err := apiConfig.DB.GetClusterSourcesForUser(ctx, database.GetClusterSourcesForUserParams{
+		UserID:     uuid.NullUUID{UUID: userID, Valid: true},
+		ClusterIds: clusterIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range sources {
+		i, ok := seen[source.ClusterID.UUID]
+		if !ok {
+			continue
+		}
+		collapsed[i].Sources = append(collapsed[i].Sources, PostSource{
+			PostID:    source.ID,
+			FeedID:    source.FeedID,
+			FeedTitle: source.FeedTitle,
+			URL:       source.Url,
+		})
+	}
+
+	return collapsed, nil
+}
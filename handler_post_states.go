@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (apiConfig *apiConfig) handlerMarkPostRead(w http.ResponseWriter, r *http.Request) {
+	apiConfig.setPostRead(w, r, true)
+}
+
+func (apiConfig *apiConfig) handlerMarkPostUnread(w http.ResponseWriter, r *http.Request) {
+	apiConfig.setPostRead(w, r, false)
+}
+
+func (apiConfig *apiConfig) setPostRead(w http.ResponseWriter, r *http.Request, read bool) {
+
+	postIdUuid, err := uuid.Parse(chi.URLParam(r, "postId"))
+	if err != nil {
+		log.Println("Error parsing post ID: ", fmt.Errorf("error parsing post ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	updated, err := apiConfig.DB.SetPostsRead(r.Context(), database.SetPostsReadParams{
+		UserID:  user.ID,
+		PostIds: []uuid.UUID{postIdUuid},
+		ReadAt:  readTime(read),
+	})
+	if err != nil {
+		log.Println("Error updating post state: ", fmt.Errorf("error updating post state: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating post state")
+		return
+	}
+	// Posts of feeds the user doesn't follow are not theirs to mark
+	if len(updated) == 0 {
+		responseWithError(w, http.StatusNotFound, "post not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerHidePost leaves a post out of the timeline, as the hide action of
+// filter rules does.
+func (apiConfig *apiConfig) handlerHidePost(w http.ResponseWriter, r *http.Request) {
+	apiConfig.setPostHidden(w, r, true)
+}
+
+func (apiConfig *apiConfig) handlerUnhidePost(w http.ResponseWriter, r *http.Request) {
+	apiConfig.setPostHidden(w, r, false)
+}
+
+func (apiConfig *apiConfig) setPostHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+
+	postIdUuid, err := uuid.Parse(chi.URLParam(r, "postId"))
+	if err != nil {
+		log.Println("Error parsing post ID: ", fmt.Errorf("error parsing post ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	updated, err := apiConfig.DB.SetPostHidden(r.Context(), database.SetPostHiddenParams{
+		UserID:   user.ID,
+		HiddenAt: readTime(hidden),
+		PostID:   postIdUuid,
+	})
+	if err != nil {
+		log.Println("Error updating post state: ", fmt.Errorf("error updating post state: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating post state")
+		return
+	}
+	if updated == 0 {
+		responseWithError(w, http.StatusNotFound, "post not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (apiConfig *apiConfig) handlerBulkMarkPostsRead(w http.ResponseWriter, r *http.Request) {
+	apiConfig.bulkSetPostsRead(w, r, true)
+}
+
+func (apiConfig *apiConfig) handlerBulkMarkPostsUnread(w http.ResponseWriter, r *http.Request) {
+	apiConfig.bulkSetPostsRead(w, r, false)
+}
+
+func (apiConfig *apiConfig) bulkSetPostsRead(w http.ResponseWriter, r *http.Request, read bool) {
+
+	type parameters struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+
+	type response struct {
+		Updated  []uuid.UUID `json:"updated"`
+		NotFound []uuid.UUID `json:"not_found"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if len(params.IDs) == 0 {
+		responseWithError(w, http.StatusBadRequest, "ids must not be empty")
+		return
+	}
+
+	updatedIds, err := apiConfig.DB.SetPostsRead(r.Context(), database.SetPostsReadParams{
+		UserID:  user.ID,
+		PostIds: params.IDs,
+		ReadAt:  readTime(read),
+	})
+	if err != nil {
+		log.Println("Error updating post states: ", fmt.Errorf("error updating post states: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating post states")
+		return
+	}
+
+	updated := map[uuid.UUID]bool{}
+	for _, id := range updatedIds {
+		updated[id] = true
+	}
+
+	result := response{Updated: updatedIds, NotFound: []uuid.UUID{}}
+	if result.Updated == nil {
+		result.Updated = []uuid.UUID{}
+	}
+	for _, id := range params.IDs {
+		if !updated[id] {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+
+	responseWithJSON(w, http.StatusOK, result)
+}
+
+// handlerMarkFeedRead marks every post of a followed feed published before a
+// point in time as read, by default everything fetched so far.
+func (apiConfig *apiConfig) handlerMarkFeedRead(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Before *time.Time `json:"before"`
+	}
+
+	type response struct {
+		Marked int64 `json:"marked"`
+	}
+
+	feedIdUuid, err := uuid.Parse(chi.URLParam(r, "feedId"))
+	if err != nil {
+		log.Println("Error parsing feed ID: ", fmt.Errorf("error parsing feed ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid feed ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	// The body is optional
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	following, err := apiConfig.DB.IsFollowingFeed(r.Context(), database.IsFollowingFeedParams{
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		FeedID: uuid.NullUUID{UUID: feedIdUuid, Valid: true},
+	})
+	if err != nil {
+		log.Println("Error checking feed follow: ", fmt.Errorf("error checking feed follow: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating post states")
+		return
+	}
+	if !following {
+		responseWithError(w, http.StatusNotFound, "not following this feed")
+		return
+	}
+
+	now := time.Now().UTC()
+	before := now
+	if params.Before != nil {
+		before = *params.Before
+	}
+
+	marked, err := apiConfig.DB.MarkFeedReadBefore(r.Context(), database.MarkFeedReadBeforeParams{
+		UserID:          user.ID,
+		FeedID:          feedIdUuid,
+		PublishedBefore: before,
+		ReadAt:          now,
+	})
+	if err != nil {
+		log.Println("Error marking feed read: ", fmt.Errorf("error marking feed read: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error updating post states")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, response{Marked: marked})
+}
+
+func readTime(read bool) sql.NullTime {
+	if !read {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.Now().UTC(), Valid: true}
+}
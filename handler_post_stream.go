@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// streamHeartbeatInterval keeps proxies from closing idle streams
+	streamHeartbeatInterval = 15 * time.Second
+	// streamRetry is how long clients wait before reconnecting
+	streamRetry = 5 * time.Second
+	// maxStreamReplay bounds the posts sent again on reconnection, a client
+	// further behind gets them over several connections
+	maxStreamReplay = 500
+)
+
+// handlerStreamPosts pushes the posts of the feeds the user follows as
+// Server-Sent Events, as soon as the scraper stores them. The event ID is the
+// number the database gives posts in the order they are stored: a client
+// reconnecting with the Last-Event-ID header first gets the posts stored
+// since that one. When there are more than maxStreamReplay of them, the
+// stream sends a truncated event after the first ones and closes, the client
+// reconnects to get the rest.
+func (apiConfig *apiConfig) handlerStreamPosts(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		responseWithError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	afterSeq, err := apiConfig.streamPosition(r, lastEventID)
+	if errors.Is(err, errInvalidLastEventID) {
+		responseWithError(w, http.StatusBadRequest, "invalid Last-Event-ID")
+		return
+	}
+	if err != nil {
+		log.Println("Error getting stream position: ", fmt.Errorf("error getting stream position: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error streaming posts")
+		return
+	}
+
+	// Subscribed before replaying, no post is stored in between unseen
+	posts := apiConfig.Posts.subscribe()
+	defer apiConfig.Posts.unsubscribe(posts)
+
+	userID := uuid.NullUUID{UUID: user.ID, Valid: true}
+	followed, err := apiConfig.followedFeeds(r, userID)
+	if err != nil {
+		log.Println("Error getting followed feeds: ", fmt.Errorf("error getting followed feeds: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error streaming posts")
+		return
+	}
+
+	var replay []database.Post
+	if lastEventID != "" {
+		replay, err = apiConfig.DB.GetPostsForUserAfterSeq(r.Context(), database.GetPostsForUserAfterSeqParams{
+			UserID:   userID,
+			AfterSeq: afterSeq,
+			RowLimit: maxStreamReplay + 1,
+		})
+		if err != nil {
+			log.Println("Error getting posts to replay: ", fmt.Errorf("error getting posts to replay: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error streaming posts")
+			return
+		}
+	}
+	truncated := len(replay) > maxStreamReplay
+	if truncated {
+		replay = replay[:maxStreamReplay]
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stops nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	for _, post := range replay {
+		if err := writePostEvent(w, post); err != nil {
+			return
+		}
+		afterSeq = post.Seq
+	}
+	if truncated {
+		// The ID is the last post sent, reconnecting resumes after it
+		fmt.Fprintf(w, "id: %d\nevent: truncated\ndata: {}\n\n", afterSeq)
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case post, ok := <-posts:
+			// Dropped for falling behind, the client reconnects and resumes
+			if !ok {
+				return
+			}
+			// Posts up to afterSeq were replayed
+			if !followed[post.FeedID.UUID] || post.Seq <= afterSeq {
+				continue
+			}
+			// Filter rules run before posts are published, a post hidden by
+			// one is hidden by now
+			hidden, err := apiConfig.DB.IsPostHidden(r.Context(), database.IsPostHiddenParams{
+				UserID: user.ID,
+				PostID: post.ID,
+			})
+			if err != nil {
+				log.Println("Error checking post state: ", fmt.Errorf("error checking post state: %w", err))
+			}
+			if hidden {
+				continue
+			}
+			if err := writePostEvent(w, post); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			// Feeds followed or unfollowed since the stream was opened
+			if refreshed, err := apiConfig.followedFeeds(r, userID); err != nil {
+				log.Println("Error getting followed feeds: ", fmt.Errorf("error getting followed feeds: %w", err))
+			} else {
+				followed = refreshed
+			}
+		}
+	}
+}
+
+func (apiConfig *apiConfig) followedFeeds(r *http.Request, userID uuid.NullUUID) (map[uuid.UUID]bool, error) {
+	feedIDs, err := apiConfig.DB.GetFollowedFeedIDs(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	followed := make(map[uuid.UUID]bool, len(feedIDs))
+	for _, feedID := range feedIDs {
+		followed[feedID.UUID] = true
+	}
+	return followed, nil
+}
+
+var errInvalidLastEventID = errors.New("invalid Last-Event-ID")
+
+// streamPosition returns the number of the post a Last-Event-ID refers to.
+// Streams used to send post IDs as event IDs, clients resuming from one are
+// still served.
+func (apiConfig *apiConfig) streamPosition(r *http.Request, lastEventID string) (int64, error) {
+	if lastEventID == "" {
+		return 0, nil
+	}
+
+	if seq, err := strconv.ParseInt(lastEventID, 10, 64); err == nil && seq >= 0 {
+		return seq, nil
+	}
+
+	postID, err := uuid.Parse(lastEventID)
+	if err != nil {
+		return 0, errInvalidLastEventID
+	}
+	post, err := apiConfig.DB.GetPostByID(r.Context(), postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errInvalidLastEventID
+	}
+	if err != nil {
+		return 0, err
+	}
+	return post.Seq, nil
+}
+
+func writePostEvent(w io.Writer, post database.Post) error {
+	payload, err := json.Marshal(databaseToPost(post))
+	if err != nil {
+		log.Println("Error encoding post: ", fmt.Errorf("error encoding post: %w", err))
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: post\ndata: %s\n\n", post.Seq, payload)
+	return err
+}
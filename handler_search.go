@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxSearchOffset bounds how deep clients can page into search results, every
+// page re-ranks all the rows skipped before it.
+const maxSearchOffset = 1000
+
+func (apiConfig *apiConfig) handlerSearchPosts(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	tsQuery, err := parseSearchQuery(query.Get("q"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Results are ordered by relevance, which cursors over (time, id) can't
+	// follow, so search pages with limit and offset instead.
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if page.Before != nil || page.After != nil {
+		responseWithError(w, http.StatusBadRequest, "search results are paged with offset, not before or after")
+		return
+	}
+
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 || offset > maxSearchOffset {
+			responseWithError(w, http.StatusBadRequest, fmt.Sprintf("offset must be between 0 and %d", maxSearchOffset))
+			return
+		}
+	}
+
+	params := database.SearchPostsForUserParams{
+		Query:     tsQuery,
+		UserID:    uuid.NullUUID{UUID: user.ID, Valid: true},
+		RowLimit:  page.Limit + 1,
+		RowOffset: int32(offset),
+	}
+	for name, bound := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				responseWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be an RFC 3339 timestamp", name))
+				return
+			}
+			*bound = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+
+	results, err := apiConfig.DB.SearchPostsForUser(r.Context(), params)
+	if err != nil {
+		log.Println("Error searching posts: ", fmt.Errorf("error searching posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error searching posts")
+		return
+	}
+
+	if len(results) > int(page.Limit) {
+		results = results[:page.Limit]
+		if next := offset + int(page.Limit); next <= maxSearchOffset {
+			u := *r.URL
+			values := u.Query()
+			values.Set("offset", strconv.Itoa(next))
+			u.RawQuery = values.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.String()))
+		}
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseSearchResultsToSearchResults(results))
+}
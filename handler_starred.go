@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (apiConfig *apiConfig) handlerStarPost(w http.ResponseWriter, r *http.Request) {
+
+	postIdUuid, err := uuid.Parse(chi.URLParam(r, "postId"))
+	if err != nil {
+		log.Println("Error parsing post ID: ", fmt.Errorf("error parsing post ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	starredPost, err := apiConfig.DB.StarPost(r.Context(), database.StarPostParams{
+		ID:     uuid.New(),
+		UserID: user.ID,
+		PostID: postIdUuid,
+	})
+	// Only posts of followed feeds can be starred
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		log.Println("Error starring post: ", fmt.Errorf("error starring post: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error starring post")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToStarredPost(starredPost))
+}
+
+func (apiConfig *apiConfig) handlerUnstarPost(w http.ResponseWriter, r *http.Request) {
+
+	postIdUuid, err := uuid.Parse(chi.URLParam(r, "postId"))
+	if err != nil {
+		log.Println("Error parsing post ID: ", fmt.Errorf("error parsing post ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid post ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	deleted, err := apiConfig.DB.UnstarPost(r.Context(), database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: uuid.NullUUID{UUID: postIdUuid, Valid: true},
+	})
+	if err != nil {
+		log.Println("Error unstarring post: ", fmt.Errorf("error unstarring post: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error unstarring post")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "post is not starred")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (apiConfig *apiConfig) handlerGetStarredPosts(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var starredPosts []database.StarredPost
+	if page.After != nil {
+		starredPosts, err = apiConfig.DB.GetStarredPostsAfter(r.Context(), database.GetStarredPostsAfterParams{
+			UserID:    user.ID,
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+	} else {
+		starredPosts, err = apiConfig.DB.GetStarredPosts(r.Context(), database.GetStarredPostsParams{
+			UserID:     user.ID,
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Println("Error listing starred posts: ", fmt.Errorf("error listing starred posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing starred posts")
+		return
+	}
+
+	starredPosts = paginate(w, r, page, starredPosts, func(starredPost database.StarredPost) pageCursor {
+		return pageCursor{Time: starredPost.CreatedAt.Time, ID: starredPost.ID}
+	})
+
+	responseWithJSON(w, http.StatusOK, databaseStarredPostsToStarredPosts(starredPosts))
+}
+
+// handlerDeleteStarredPost removes a saved copy by its own ID, which still
+// works after the original post is gone.
+func (apiConfig *apiConfig) handlerDeleteStarredPost(w http.ResponseWriter, r *http.Request) {
+
+	starredIdUuid, err := uuid.Parse(chi.URLParam(r, "starredId"))
+	if err != nil {
+		log.Println("Error parsing starred post ID: ", fmt.Errorf("error parsing starred post ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid starred post ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteStarredPost(r.Context(), database.DeleteStarredPostParams{
+		UserID: user.ID,
+		ID:     starredIdUuid,
+	})
+	if err != nil {
+		log.Println("Error deleting starred post: ", fmt.Errorf("error deleting starred post: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting starred post")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "starred post not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxTagNameLength = 64
+
+// parseTagNames normalizes tag names given as repeated or comma separated
+// values. Tags are compared lowercased, duplicates are dropped.
+func parseTagNames(values []string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" || seen[name] {
+				continue
+			}
+			if utf8.RuneCountInString(name) > maxTagNameLength {
+				return nil, fmt.Errorf("tag %q is longer than %d characters", name, maxTagNameLength)
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// postTagsParameters is the payload of the bulk tagging endpoints.
+type postTagsParameters struct {
+	PostIDs []uuid.UUID `json:"post_ids"`
+	Tags    []string    `json:"tags"`
+}
+
+func decodePostTagsParameters(w http.ResponseWriter, r *http.Request) (postTagsParameters, bool) {
+	var params postTagsParameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return params, false
+	}
+
+	if len(params.PostIDs) == 0 {
+		responseWithError(w, http.StatusBadRequest, "post_ids must not be empty")
+		return params, false
+	}
+
+	var err error
+	if params.Tags, err = parseTagNames(params.Tags); err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return params, false
+	}
+	if len(params.Tags) == 0 {
+		responseWithError(w, http.StatusBadRequest, "tags must not be empty")
+		return params, false
+	}
+
+	return params, true
+}
+
+// handlerTagPosts adds tags to posts of followed feeds, creating the tags
+// that don't exist yet.
+func (apiConfig *apiConfig) handlerTagPosts(w http.ResponseWriter, r *http.Request) {
+
+	type response struct {
+		Tagged   []uuid.UUID `json:"tagged"`
+		NotFound []uuid.UUID `json:"not_found"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	params, ok := decodePostTagsParameters(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Println("Error starting transaction: ", fmt.Errorf("error starting transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error tagging posts")
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiConfig.DB.WithTx(tx)
+
+	postIds, err := qtx.GetFollowedPostIDs(r.Context(), database.GetFollowedPostIDsParams{
+		UserID:  user.ID,
+		PostIds: params.PostIDs,
+	})
+	if err != nil {
+		log.Println("Error getting posts: ", fmt.Errorf("error getting posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error tagging posts")
+		return
+	}
+
+	if len(postIds) > 0 {
+		ids := make([]uuid.UUID, len(params.Tags))
+		for i := range ids {
+			ids[i] = uuid.New()
+		}
+
+		tags, err := qtx.UpsertTags(r.Context(), database.UpsertTagsParams{
+			Ids:    ids,
+			UserID: user.ID,
+			Names:  params.Tags,
+		})
+		if err != nil {
+			log.Println("Error creating tags: ", fmt.Errorf("error creating tags: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error tagging posts")
+			return
+		}
+
+		tagIds := make([]uuid.UUID, len(tags))
+		for i, tag := range tags {
+			tagIds[i] = tag.ID
+		}
+
+		if _, err := qtx.TagPosts(r.Context(), database.TagPostsParams{
+			TagIds:  tagIds,
+			PostIds: postIds,
+		}); err != nil {
+			log.Println("Error tagging posts: ", fmt.Errorf("error tagging posts: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error tagging posts")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction: ", fmt.Errorf("error committing transaction: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error tagging posts")
+		return
+	}
+
+	tagged := map[uuid.UUID]bool{}
+	for _, id := range postIds {
+		tagged[id] = true
+	}
+
+	result := response{Tagged: postIds, NotFound: []uuid.UUID{}}
+	if result.Tagged == nil {
+		result.Tagged = []uuid.UUID{}
+	}
+	for _, id := range params.PostIDs {
+		if !tagged[id] {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+
+	responseWithJSON(w, http.StatusOK, result)
+}
+
+// handlerUntagPosts removes tags from posts. Tags left without posts are
+// kept, they are deleted on their own.
+func (apiConfig *apiConfig) handlerUntagPosts(w http.ResponseWriter, r *http.Request) {
+
+	type response struct {
+		Removed int64 `json:"removed"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	params, ok := decodePostTagsParameters(w, r)
+	if !ok {
+		return
+	}
+
+	removed, err := apiConfig.DB.UntagPosts(r.Context(), database.UntagPostsParams{
+		UserID:  user.ID,
+		Names:   params.Tags,
+		PostIds: params.PostIDs,
+	})
+	if err != nil {
+		log.Println("Error untagging posts: ", fmt.Errorf("error untagging posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error untagging posts")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, response{Removed: removed})
+}
+
+func (apiConfig *apiConfig) handlerGetTags(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var dbTags []database.GetTagsWithCountsRow
+	if page.After != nil {
+		var rows []database.GetTagsWithCountsAfterRow
+		rows, err = apiConfig.DB.GetTagsWithCountsAfter(r.Context(), database.GetTagsWithCountsAfterParams{
+			UserID:    user.ID,
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+		for _, row := range rows {
+			dbTags = append(dbTags, database.GetTagsWithCountsRow(row))
+		}
+	} else {
+		dbTags, err = apiConfig.DB.GetTagsWithCounts(r.Context(), database.GetTagsWithCountsParams{
+			UserID:     user.ID,
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Println("Error listing tags: ", fmt.Errorf("error listing tags: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing tags")
+		return
+	}
+
+	dbTags = paginate(w, r, page, dbTags, func(dbTag database.GetTagsWithCountsRow) pageCursor {
+		return pageCursor{Time: dbTag.CreatedAt.Time, ID: dbTag.ID}
+	})
+
+	tags := make([]Tag, len(dbTags))
+	for i, dbTag := range dbTags {
+		tags[i] = Tag{
+			ID:        dbTag.ID,
+			Name:      dbTag.Name,
+			PostCount: dbTag.PostCount,
+			CreatedAt: dbTag.CreatedAt.Time,
+		}
+	}
+
+	responseWithJSON(w, http.StatusOK, tags)
+}
+
+func (apiConfig *apiConfig) handlerDeleteTag(w http.ResponseWriter, r *http.Request) {
+
+	tagIdUuid, err := uuid.Parse(chi.URLParam(r, "tagId"))
+	if err != nil {
+		log.Println("Error parsing tag ID: ", fmt.Errorf("error parsing tag ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid tag ID")
+		return
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteTag(r.Context(), database.DeleteTagParams{
+		ID:     tagIdUuid,
+		UserID: user.ID,
+	})
+	if err != nil {
+		log.Println("Error deleting tag: ", fmt.Errorf("error deleting tag: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting tag")
+		return
+	}
+	if deleted == 0 {
+		responseWithError(w, http.StatusNotFound, "tag not found")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
@@ -22,9 +22,17 @@ func (apiConfig *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	feedToken, err := newSecretToken()
+	if err != nil {
+		log.Println("Error generating feed token: ", fmt.Errorf("error generating feed token: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating user")
+		return
+	}
+
 	createdUser, err := apiConfig.DB.CreateUser(r.Context(), database.CreateUserParams{
-		ID:   uuid.New(),
-		Name: params.Name,
+		ID:        uuid.New(),
+		Name:      params.Name,
+		FeedToken: feedToken,
 	})
 
 	if err != nil {
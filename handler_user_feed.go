@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// handlerGetUserFeed publishes the posts of the feeds a user follows as an
+// RSS, Atom or JSON feed. Feed readers can't send the Authorization header, the
+// request is authenticated by the user's feed token instead.
+func (apiConfig *apiConfig) handlerGetUserFeed(w http.ResponseWriter, r *http.Request) {
+
+	format := chi.URLParam(r, "format")
+	if !isFeedFormat(format) {
+		responseWithError(w, http.StatusNotFound, errUnknownFeedFormat.Error())
+		return
+	}
+
+	userIdUuid, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+
+	// Unknown users and wrong tokens get the same answer
+	token := r.URL.Query().Get("token")
+	user, err := apiConfig.DB.GetUserByID(r.Context(), userIdUuid)
+	if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(user.FeedToken)) != 1 {
+		responseWithError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+
+	limit, err := publishedFeedLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, err := apiConfig.DB.GetPostsForUser(r.Context(), database.GetPostsForUserParams{
+		UserID:   uuid.NullUUID{UUID: user.ID, Valid: true},
+		RowLimit: limit,
+	})
+	if err != nil {
+		log.Println("Error getting posts: ", fmt.Errorf("error getting posts: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting posts")
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	feed := publishedFeed{
+		ID:      "urn:uuid:" + user.ID.String(),
+		Title:   user.Name + "'s timeline",
+		HomeURL: baseURL,
+		SelfURL: baseURL + r.URL.RequestURI()[1:],
+		Updated: time.Now(),
+		Posts:   databasePostsToPosts(posts),
+	}
+	if len(posts) > 0 {
+		feed.Updated = posts[0].PublishedAt
+	}
+
+	writePublishedFeed(w, format, feed)
+}
+
+// handlerRotateFeedToken replaces the user's feed token, the URLs of the
+// published timeline handed out so far stop working.
+func (apiConfig *apiConfig) handlerRotateFeedToken(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	feedToken, err := newSecretToken()
+	if err != nil {
+		log.Println("Error generating feed token: ", fmt.Errorf("error generating feed token: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error rotating feed token")
+		return
+	}
+
+	updatedUser, err := apiConfig.DB.RotateFeedToken(r.Context(), database.RotateFeedTokenParams{
+		ID:        user.ID,
+		FeedToken: feedToken,
+	})
+	if err != nil {
+		log.Println("Error rotating feed token: ", fmt.Errorf("error rotating feed token: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error rotating feed token")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToUser(updatedUser))
+}
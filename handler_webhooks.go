@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func (apiConfig *apiConfig) handlerCreateWebhook(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		URL string `json:"url"`
+		// Secret is generated when left out
+		Secret   string        `json:"secret"`
+		FeedID   uuid.NullUUID `json:"feed_id"`
+		Keywords []string      `json:"keywords"`
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Println("Error decoding request body: ", fmt.Errorf("error decoding request body: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if validationErr := validateFeedURL(params.URL); validationErr != nil {
+		responseWithError(w, http.StatusBadRequest, validationErr.Message)
+		return
+	}
+
+	// Checked again on every delivery, the name may be re-pointed later
+	webhookURL, _ := url.Parse(params.URL)
+	err = apiConfig.Webhooks.guard.checkHost(r.Context(), webhookURL.Hostname())
+	if errors.Is(err, errNonPublicAddress) {
+		responseWithError(w, http.StatusBadRequest, "url must point to a public address")
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, "url host could not be resolved")
+		return
+	}
+
+	if params.Secret == "" {
+		if params.Secret, err = newSecretToken(); err != nil {
+			log.Println("Error generating webhook secret: ", fmt.Errorf("error generating webhook secret: %w", err))
+			responseWithError(w, http.StatusInternalServerError, "error creating webhook")
+			return
+		}
+	}
+
+	keywords := []string{}
+	for _, keyword := range params.Keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+
+	webhook, err := apiConfig.DB.CreateWebhook(r.Context(), database.CreateWebhookParams{
+		ID:       uuid.New(),
+		UserID:   user.ID,
+		Url:      params.URL,
+		Secret:   params.Secret,
+		FeedID:   params.FeedID,
+		Keywords: keywords,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		responseWithError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+	if err != nil {
+		log.Println("Error creating webhook: ", fmt.Errorf("error creating webhook: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error creating webhook")
+		return
+	}
+
+	// The secret is shown once, to configure the receiver
+	created := databaseToWebhook(webhook)
+	created.Secret = webhook.Secret
+
+	responseWithJSON(w, http.StatusOK, created)
+}
+
+func (apiConfig *apiConfig) handlerGetWebhooks(w http.ResponseWriter, r *http.Request) {
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var dbWebhooks []database.Webhook
+	if page.After != nil {
+		dbWebhooks, err = apiConfig.DB.GetWebhooksAfter(r.Context(), database.GetWebhooksAfterParams{
+			UserID:    user.ID,
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+	} else {
+		dbWebhooks, err = apiConfig.DB.GetWebhooks(r.Context(), database.GetWebhooksParams{
+			UserID:     user.ID,
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Println("Error listing webhooks: ", fmt.Errorf("error listing webhooks: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing webhooks")
+		return
+	}
+
+	dbWebhooks = paginate(w, r, page, dbWebhooks, func(dbWebhook database.Webhook) pageCursor {
+		return pageCursor{Time: dbWebhook.CreatedAt.Time, ID: dbWebhook.ID}
+	})
+
+	webhooks := make([]Webhook, len(dbWebhooks))
+	for i, dbWebhook := range dbWebhooks {
+		webhooks[i] = databaseToWebhook(dbWebhook)
+	}
+
+	responseWithJSON(w, http.StatusOK, webhooks)
+}
+
+func (apiConfig *apiConfig) handlerDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := apiConfig.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := apiConfig.DB.DeleteWebhook(r.Context(), database.DeleteWebhookParams{
+		ID:     webhook.ID,
+		UserID: webhook.UserID,
+	}); err != nil {
+		log.Println("Error deleting webhook: ", fmt.Errorf("error deleting webhook: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error deleting webhook")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerGetWebhookDeliveries lists the deliveries of a webhook, newest first.
+func (apiConfig *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := apiConfig.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var deliveries []database.WebhookDelivery
+	if page.After != nil {
+		deliveries, err = apiConfig.DB.GetWebhookDeliveriesAfter(r.Context(), database.GetWebhookDeliveriesAfterParams{
+			WebhookID: webhook.ID,
+			AfterTime: page.After.Time,
+			AfterID:   page.After.ID,
+			RowLimit:  page.Limit + 1,
+		})
+	} else {
+		deliveries, err = apiConfig.DB.GetWebhookDeliveries(r.Context(), database.GetWebhookDeliveriesParams{
+			WebhookID:  webhook.ID,
+			BeforeTime: page.beforeTime(),
+			BeforeID:   page.beforeID(),
+			RowLimit:   page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Println("Error listing webhook deliveries: ", fmt.Errorf("error listing webhook deliveries: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error listing webhook deliveries")
+		return
+	}
+
+	deliveries = paginate(w, r, page, deliveries, func(delivery database.WebhookDelivery) pageCursor {
+		return pageCursor{Time: delivery.CreatedAt.Time, ID: delivery.ID}
+	})
+
+	responseWithJSON(w, http.StatusOK, databaseWebhookDeliveriesToWebhookDeliveries(deliveries))
+}
+
+// handlerTestWebhook sends a ping event to the webhook and returns the
+// outcome.
+func (apiConfig *apiConfig) handlerTestWebhook(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := apiConfig.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := json.Marshal(webhookPayload{Event: webhookEventPing, WebhookID: webhook.ID})
+	if err != nil {
+		log.Println("Error encoding webhook payload: ", fmt.Errorf("error encoding webhook payload: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error testing webhook")
+		return
+	}
+
+	// Not cut short when the client goes away, the outcome must be recorded
+	ctx, cancel := context.WithTimeout(context.Background(), 2*webhookTimeout)
+	defer cancel()
+
+	delivery, err := apiConfig.Webhooks.deliverNow(ctx, webhook, uuid.NullUUID{}, webhookEventPing, payload)
+	if err != nil {
+		log.Println("Error testing webhook: ", fmt.Errorf("error testing webhook: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error testing webhook")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToWebhookDelivery(delivery))
+}
+
+// handlerRedeliverWebhookDelivery sends the payload of a past delivery again,
+// as a new delivery, and returns its outcome.
+func (apiConfig *apiConfig) handlerRedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+
+	deliveryIdUuid, err := uuid.Parse(chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		log.Println("Error parsing delivery ID: ", fmt.Errorf("error parsing delivery ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid delivery ID")
+		return
+	}
+
+	webhook, ok := apiConfig.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	original, err := apiConfig.DB.GetWebhookDelivery(r.Context(), database.GetWebhookDeliveryParams{
+		ID:        deliveryIdUuid,
+		WebhookID: webhook.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "delivery not found")
+		return
+	}
+	if err != nil {
+		log.Println("Error getting webhook delivery: ", fmt.Errorf("error getting webhook delivery: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error redelivering")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*webhookTimeout)
+	defer cancel()
+
+	delivery, err := apiConfig.Webhooks.deliverNow(ctx, webhook, original.PostID, original.Event, original.Payload)
+	if err != nil {
+		log.Println("Error redelivering webhook delivery: ", fmt.Errorf("error redelivering webhook delivery: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error redelivering")
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, databaseToWebhookDelivery(delivery))
+}
+
+// webhookFromRequest loads the user's webhook named by the webhookId URL
+// parameter, writing the error response when there is none.
+func (apiConfig *apiConfig) webhookFromRequest(w http.ResponseWriter, r *http.Request) (database.Webhook, bool) {
+	webhookIdUuid, err := uuid.Parse(chi.URLParam(r, "webhookId"))
+	if err != nil {
+		log.Println("Error parsing webhook ID: ", fmt.Errorf("error parsing webhook ID: %w", err))
+		responseWithError(w, http.StatusBadRequest, "invalid webhook ID")
+		return database.Webhook{}, false
+	}
+
+	user, err := getUserFromContext(r)
+	if err != nil {
+		responseWithError(w, http.StatusUnauthorized, "unauthorized")
+		return database.Webhook{}, false
+	}
+
+	webhook, err := apiConfig.DB.GetWebhook(r.Context(), database.GetWebhookParams{
+		ID:     webhookIdUuid,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		responseWithError(w, http.StatusNotFound, "webhook not found")
+		return webhook, false
+	}
+	if err != nil {
+		log.Println("Error getting webhook: ", fmt.Errorf("error getting webhook: %w", err))
+		responseWithError(w, http.StatusInternalServerError, "error getting webhook")
+		return webhook, false
+	}
+	return webhook, true
+}
@@ -6,19 +6,47 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Collection struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Slug        string
+	Name        string
+	Description sql.NullString
+	CreatedAt   sql.NullTime
+	UpdatedAt   sql.NullTime
+}
+
+type CollectionFeed struct {
+	CollectionID uuid.UUID
+	FeedID       uuid.UUID
+	CreatedAt    sql.NullTime
+}
+
+type CollectionSubscription struct {
+	CollectionID   uuid.UUID
+	UserID         uuid.UUID
+	TrackAdditions bool
+	CreatedAt      sql.NullTime
+	UpdatedAt      sql.NullTime
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	Url           string
-	Title         string
-	CreatedAt     sql.NullTime
-	UpdatedAt     sql.NullTime
-	UserID        uuid.NullUUID
-	LastFetchedAt sql.NullTime
+	ID                  uuid.UUID
+	Url                 string
+	Title               string
+	CreatedAt           sql.NullTime
+	UpdatedAt           sql.NullTime
+	UserID              uuid.NullUUID
+	LastFetchedAt       sql.NullTime
+	FetchFullContent    bool
+	Enabled             bool
+	PollIntervalMinutes sql.NullInt32
 }
 
 type FeedFollow struct {
@@ -27,18 +55,113 @@ type FeedFollow struct {
 	UpdatedAt sql.NullTime
 	UserID    uuid.NullUUID
 	FeedID    uuid.NullUUID
+	Title     sql.NullString
+	FolderID  uuid.NullUUID
+}
+
+type FilterRule struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	FeedFollowID uuid.NullUUID
+	Name         string
+	Field        string
+	Keywords     []string
+	Regex        sql.NullString
+	Action       string
+	Tag          sql.NullString
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+}
+
+type Folder struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	Name      string
+	CreatedAt sql.NullTime
+	UpdatedAt sql.NullTime
+}
+
+type OpmlImport struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Status     string
+	Error      sql.NullString
+	CreatedAt  sql.NullTime
+	UpdatedAt  sql.NullTime
+	FinishedAt sql.NullTime
+}
+
+type OpmlImportItem struct {
+	ID        uuid.UUID
+	ImportID  uuid.UUID
+	Position  int32
+	Url       string
+	Title     string
+	Folder    string
+	Subfolder string
+	Status    string
+	FeedID    uuid.NullUUID
+	Error     sql.NullString
 }
 
 type Post struct {
+	ID           uuid.UUID
+	Url          string
+	Title        string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	FeedID       uuid.NullUUID
+	CanonicalUrl sql.NullString
+	Fingerprint  sql.NullInt64
+	ClusterID    uuid.NullUUID
+	Content      sql.NullString
+	Attachments  json.RawMessage
+	SearchVector interface{}
+	Author       sql.NullString
+	Categories   []string
+	Seq          int64
+}
+
+type PostState struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	ReadAt    sql.NullTime
+	CreatedAt sql.NullTime
+	UpdatedAt sql.NullTime
+	HiddenAt  sql.NullTime
+}
+
+type PostTag struct {
+	TagID     uuid.UUID
+	PostID    uuid.UUID
+	CreatedAt sql.NullTime
+}
+
+type StarredPost struct {
 	ID          uuid.UUID
+	UserID      uuid.UUID
+	PostID      uuid.NullUUID
+	FeedID      uuid.NullUUID
+	FeedTitle   string
 	Url         string
-	Userid      uuid.NullUUID
 	Title       string
 	Description sql.NullString
+	Content     sql.NullString
+	Attachments json.RawMessage
 	PublishedAt time.Time
 	CreatedAt   sql.NullTime
 	UpdatedAt   sql.NullTime
-	FeedID      uuid.NullUUID
+}
+
+type Tag struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	CreatedAt sql.NullTime
+	UpdatedAt sql.NullTime
 }
 
 type User struct {
@@ -47,4 +170,31 @@ type User struct {
 	CreatedAt sql.NullTime
 	UpdatedAt sql.NullTime
 	ApiKey    string
+	FeedToken string
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	FeedID    uuid.NullUUID
+	Keywords  []string
+	CreatedAt sql.NullTime
+	UpdatedAt sql.NullTime
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	WebhookID      uuid.UUID
+	PostID         uuid.NullUUID
+	Event          string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	ResponseStatus sql.NullInt32
+	Error          sql.NullString
+	NextAttemptAt  sql.NullTime
+	CreatedAt      sql.NullTime
+	UpdatedAt      sql.NullTime
 }
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// The posts timeline combines optional filters with a choice of sort key and
+// direction, which sqlc can't express without defeating the indexes. The query
+// is built here instead, by hand, next to the generated code.
+
+type TimelineSort string
+
+const (
+	TimelineSortPublished TimelineSort = "published"
+	TimelineSortIngested  TimelineSort = "ingested"
+)
+
+// TimelineCursor is the sort key and ID of the row a page starts after.
+type TimelineCursor struct {
+	Time time.Time
+	ID   uuid.UUID
+}
+
+type ListTimelineParams struct {
+	UserID uuid.UUID
+	// FeedIDs restricts the timeline to some of the followed feeds
+	FeedIDs []uuid.UUID
+	// FolderID restricts the timeline to the feeds in a folder and its
+	// subfolders
+	FolderID       uuid.NullUUID
+	Since          sql.NullTime
+	Until          sql.NullTime
+	HasAttachments sql.NullBool
+	// Unread keeps only the posts the user hasn't read, or only the read ones
+	Unread sql.NullBool
+	// Starred keeps only the posts the user starred, or only the others
+	Starred sql.NullBool
+	// Hidden keeps only the posts the user hid, or only the others
+	Hidden sql.NullBool
+	// Tags keeps the posts the user tagged with any of these tag names, or
+	// with all of them when TagsMatchAll is set
+	Tags         []string
+	TagsMatchAll bool
+	// Collapse keeps one post per story cluster, the first in list order
+	// among the posts the filters keep
+	Collapse bool
+
+	Sort      TimelineSort
+	Ascending bool
+	// Cursor skips the rows up to and including the cursor in list order.
+	// When Reverse is set rows are walked, and returned, in the opposite
+	// order, which is how the page preceding the cursor is read.
+	Cursor  *TimelineCursor
+	Reverse bool
+	Limit   int32
+}
+
+// TimelinePost is a post along with the state the user left it in.
+type TimelinePost struct {
+	Post
+	ReadAt  sql.NullTime
+	Starred bool
+	Tags    []string
+}
+
+const timelineColumns = `p.id, p.url, p.title, p.description, p.published_at, p.created_at, p.updated_at,
+	p.feed_id, p.canonical_url, p.fingerprint, p.cluster_id, p.content, p.attachments, p.author, p.categories, ps.read_at`
+
+// SortTime returns the value of the timeline sort key for a post.
+func (s TimelineSort) SortTime(post Post) time.Time {
+	if s == TimelineSortIngested {
+		return post.CreatedAt.Time
+	}
+	return post.PublishedAt
+}
+
+func (s TimelineSort) column() string {
+	if s == TimelineSortIngested {
+		return "p.created_at"
+	}
+	return "p.published_at"
+}
+
+// ListTimeline returns the posts of the feeds a user follows.
+func (q *Queries) ListTimeline(ctx context.Context, arg ListTimelineParams) ([]TimelinePost, error) {
+	var where []string
+	var args []interface{}
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	userID := param(arg.UserID)
+	follows := "SELECT ff.feed_id FROM feed_follows ff WHERE ff.user_id = " + userID
+	if len(arg.FeedIDs) > 0 {
+		follows += " AND ff.feed_id = ANY(" + param(pq.Array(arg.FeedIDs)) + "::uuid[])"
+	}
+	if arg.FolderID.Valid {
+		folderID := param(arg.FolderID.UUID)
+		follows += " AND (ff.folder_id = " + folderID + " OR ff.folder_id IN (SELECT f.id FROM folders f WHERE f.parent_id = " + folderID + "))"
+	}
+	where = append(where, "p.feed_id IN ("+follows+")")
+
+	starred := "EXISTS(SELECT 1 FROM starred_posts sp WHERE sp.user_id = " + userID + " AND sp.post_id = p.id)"
+	tagged := "FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.post_id = p.id AND t.user_id = " + userID
+	tags := "ARRAY(SELECT t.name " + tagged + " ORDER BY t.name)"
+
+	if arg.Since.Valid {
+		where = append(where, "p.published_at >= "+param(arg.Since.Time))
+	}
+	if arg.Until.Valid {
+		where = append(where, "p.published_at < "+param(arg.Until.Time))
+	}
+	if arg.HasAttachments.Valid {
+		if arg.HasAttachments.Bool {
+			where = append(where, "p.attachments <> '[]'::jsonb")
+		} else {
+			where = append(where, "p.attachments = '[]'::jsonb")
+		}
+	}
+	if arg.Unread.Valid {
+		if arg.Unread.Bool {
+			where = append(where, "ps.read_at IS NULL")
+		} else {
+			where = append(where, "ps.read_at IS NOT NULL")
+		}
+	}
+	if arg.Hidden.Valid {
+		if arg.Hidden.Bool {
+			where = append(where, "ps.hidden_at IS NOT NULL")
+		} else {
+			where = append(where, "ps.hidden_at IS NULL")
+		}
+	}
+	if arg.Starred.Valid {
+		if arg.Starred.Bool {
+			where = append(where, starred)
+		} else {
+			where = append(where, "NOT "+starred)
+		}
+	}
+	if len(arg.Tags) > 0 {
+		names := param(pq.Array(arg.Tags))
+		if arg.TagsMatchAll {
+			where = append(where, fmt.Sprintf("(SELECT count(*) %s AND t.name = ANY(%s::text[])) = %d", tagged, names, len(arg.Tags)))
+		} else {
+			where = append(where, fmt.Sprintf("EXISTS(SELECT 1 %s AND t.name = ANY(%s::text[]))", tagged, names))
+		}
+	}
+
+	sortColumn := arg.Sort.column()
+
+	// The post kept for a story doesn't depend on the cursor or the walking
+	// direction, so every page agrees on it
+	if arg.Collapse {
+		listDirection := "DESC"
+		if arg.Ascending {
+			listDirection = "ASC"
+		}
+		where = append(where, fmt.Sprintf(`p.id IN (SELECT DISTINCT ON (COALESCE(p.cluster_id, p.id)) p.id FROM posts p
+			LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = %s
+			WHERE %s ORDER BY COALESCE(p.cluster_id, p.id), %s %s, p.id %s)`,
+			userID, strings.Join(where, " AND "), sortColumn, listDirection, listDirection))
+	}
+
+	ascending := arg.Ascending != arg.Reverse
+	direction, comparison := "DESC", "<"
+	if ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if arg.Cursor != nil {
+		where = append(where, fmt.Sprintf("(%s, p.id) %s (%s, %s)",
+			sortColumn, comparison, param(arg.Cursor.Time), param(arg.Cursor.ID)))
+	}
+
+	query := fmt.Sprintf(`SELECT %s, %s, %s FROM posts p
+		LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = %s
+		WHERE %s ORDER BY %s %s, p.id %s LIMIT %s`,
+		timelineColumns, starred, tags, userID, strings.Join(where, " AND "), sortColumn, direction, direction, param(arg.Limit))
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TimelinePost
+	for rows.Next() {
+		var i TimelinePost
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Description,
+			&i.PublishedAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FeedID,
+			&i.CanonicalUrl,
+			&i.Fingerprint,
+			&i.ClusterID,
+			&i.Content,
+			&i.Attachments,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.ReadAt,
+			&i.Starred,
+			pq.Array(&i.Tags),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
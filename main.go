@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
@@ -20,6 +21,11 @@ const scrapingConcurrency = 10
 const durationInMinutes = 5 * time.Minute
 type apiConfig struct {
 	DB *database.Queries
+	DBConn *sql.DB
+	Fetcher *fetcher
+	Scraper *scraper
+	Posts *postBroker
+	Webhooks *webhookDispatcher
 }
 func main() {
 	log.Println("Starting RSS Aggregator...")
@@ -45,12 +51,57 @@ func main() {
 	}
 	defer db.Close()
 
+	sanitizer, err := newSanitizer(os.Getenv("SANITIZER_POLICY"))
+	if err != nil {
+		log.Fatalln("Invalid SANITIZER_POLICY: " + err.Error())
+	}
+
+	// New posts reach the streams of this instance only, unless they are
+	// announced through Postgres to every instance
+	postBroker := newPostBroker()
+	var posts postPublisher = postBroker
+	if os.Getenv("NOTIFY_NEW_POSTS") == "true" {
+		posts = &postNotifier{db: database.New(db)}
+		go listenForNewPosts(dbUrlString, database.New(db), postBroker)
+	}
+
+	// Feeds, articles and webhooks on loopback, private or link-local
+	// addresses are refused unless explicitly allowed
+	guard := addressGuard{allowPrivate: os.Getenv("ALLOW_PRIVATE_ADDRESSES") == "true"}
+
+	fetcher := newFetcher(fetchTimeout, maxRequestsPerHost, guard)
+
+	webhooks := newWebhookDispatcher(database.New(db), guard)
+
+	scraper := &scraper{
+		db:            database.New(db),
+		sanitizer:     sanitizer,
+		canonicalizer: newURLCanonicalizer(os.Getenv("TRACKING_PARAMS")),
+		fetcher:       fetcher,
+		posts:         posts,
+		webhooks:      webhooks,
+	}
+
 	// start scraper in a separate goroutine
 
-	go startScraping(database.New(db), scrapingConcurrency, durationInMinutes)
+	go scraper.start(scrapingConcurrency, durationInMinutes)
+
+	go webhooks.start()
 
 	apiConfig := apiConfig{
 		DB: database.New(db),
+		DBConn: db,
+		Fetcher: fetcher,
+		Scraper: scraper,
+		Posts: postBroker,
+		Webhooks: webhooks,
+	}
+
+	// Imports run in the background and don't survive a restart
+	if interrupted, err := apiConfig.DB.FailInterruptedOPMLImports(context.Background()); err != nil {
+		log.Println("Error failing interrupted OPML imports: " + err.Error())
+	} else if interrupted > 0 {
+		log.Printf("Marked %d interrupted OPML imports as failed", interrupted)
 	}
 
 	log.Println("Listening on port " + portString)
@@ -62,8 +113,8 @@ func main() {
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Last-Event-ID"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -77,12 +128,68 @@ func main() {
 	v1Router.Get("/error", handlerError)
 	v1Router.Post("/users", apiConfig.handlerCreateUser)
 	v1Router.With(apiConfig.middlewareAuth).Get("/users", apiConfig.handlerGetUser)
+	v1Router.With(apiConfig.middlewareAuth).Post("/users/feed_token", apiConfig.handlerRotateFeedToken)
+	v1Router.Get("/users/{userId}/feed.{format}", apiConfig.handlerGetUserFeed)
 	v1Router.With(apiConfig.middlewareAuth).Post("/feeds", apiConfig.handlerCreateFeed)
 	v1Router.With(apiConfig.middlewareAuth).Get("/feeds", apiConfig.handlerGetFeeds)
+	v1Router.With(apiConfig.middlewareAuth).Get("/feeds/{feedId}", apiConfig.handlerGetFeed)
+	v1Router.With(apiConfig.middlewareAuth).Patch("/feeds/{feedId}", apiConfig.handlerUpdateFeed)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/feeds/{feedId}", apiConfig.handlerDeleteFeed)
+	v1Router.With(apiConfig.middlewareAuth).Post("/feeds/{feedId}/refresh", apiConfig.handlerRefreshFeed)
+	v1Router.With(apiConfig.middlewareAuth).Get("/discover", apiConfig.handlerDiscoverFeeds)
 	v1Router.With(apiConfig.middlewareAuth).Post("/feed_follows", apiConfig.handlerCreateFeedFollows)
 	v1Router.With(apiConfig.middlewareAuth).Get("/feed_follows", apiConfig.handlerGetFeedFollows)
+	v1Router.With(apiConfig.middlewareAuth).Patch("/feed_follows/{feedFollowId}", apiConfig.handlerUpdateFeedFollows)
 	v1Router.With(apiConfig.middlewareAuth).Delete("/feed_follows/{feedFollowId}", apiConfig.handlerDeleteFeedFollows)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/feed_follows", apiConfig.handlerBulkDeleteFeedFollows)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/feeds/{feedId}/follow", apiConfig.handlerUnfollowFeed)
+	v1Router.With(apiConfig.middlewareAuth).Post("/folders", apiConfig.handlerCreateFolder)
+	v1Router.With(apiConfig.middlewareAuth).Get("/folders", apiConfig.handlerGetFolders)
+	v1Router.With(apiConfig.middlewareAuth).Patch("/folders/{folderId}", apiConfig.handlerUpdateFolder)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/folders/{folderId}", apiConfig.handlerDeleteFolder)
+	v1Router.With(apiConfig.middlewareAuth).Put("/folders/{folderId}/feed_follows", apiConfig.handlerAddFolderFeedFollows)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/folders/{folderId}/feed_follows", apiConfig.handlerRemoveFolderFeedFollows)
 	v1Router.With(apiConfig.middlewareAuth).Get("/posts", apiConfig.handlerGetPostForUser)
+	v1Router.With(apiConfig.middlewareAuth).Get("/posts/stream", apiConfig.handlerStreamPosts)
+	v1Router.With(apiConfig.middlewareAuth).Put("/posts/{postId}/read", apiConfig.handlerMarkPostRead)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/posts/{postId}/read", apiConfig.handlerMarkPostUnread)
+	v1Router.With(apiConfig.middlewareAuth).Post("/posts/read", apiConfig.handlerBulkMarkPostsRead)
+	v1Router.With(apiConfig.middlewareAuth).Post("/posts/unread", apiConfig.handlerBulkMarkPostsUnread)
+	v1Router.With(apiConfig.middlewareAuth).Post("/feeds/{feedId}/read", apiConfig.handlerMarkFeedRead)
+	v1Router.With(apiConfig.middlewareAuth).Put("/posts/{postId}/hide", apiConfig.handlerHidePost)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/posts/{postId}/hide", apiConfig.handlerUnhidePost)
+	v1Router.With(apiConfig.middlewareAuth).Put("/posts/{postId}/star", apiConfig.handlerStarPost)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/posts/{postId}/star", apiConfig.handlerUnstarPost)
+	v1Router.With(apiConfig.middlewareAuth).Get("/starred", apiConfig.handlerGetStarredPosts)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/starred/{starredId}", apiConfig.handlerDeleteStarredPost)
+	v1Router.With(apiConfig.middlewareAuth).Post("/posts/tags", apiConfig.handlerTagPosts)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/posts/tags", apiConfig.handlerUntagPosts)
+	v1Router.With(apiConfig.middlewareAuth).Get("/tags", apiConfig.handlerGetTags)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/tags/{tagId}", apiConfig.handlerDeleteTag)
+	v1Router.With(apiConfig.middlewareAuth).Post("/opml", apiConfig.handlerImportOPML)
+	v1Router.With(apiConfig.middlewareAuth).Get("/opml", apiConfig.handlerExportOPML)
+	v1Router.With(apiConfig.middlewareAuth).Get("/opml/imports/{importId}", apiConfig.handlerGetOPMLImport)
+	v1Router.With(apiConfig.middlewareAuth).Get("/search", apiConfig.handlerSearchPosts)
+	v1Router.With(apiConfig.middlewareAuth).Post("/rules", apiConfig.handlerCreateFilterRule)
+	v1Router.With(apiConfig.middlewareAuth).Get("/rules", apiConfig.handlerGetFilterRules)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/rules/{ruleId}", apiConfig.handlerDeleteFilterRule)
+	v1Router.With(apiConfig.middlewareAuth).Post("/rules/dry_run", apiConfig.handlerDryRunFilterRule)
+	v1Router.With(apiConfig.middlewareAuth).Post("/webhooks", apiConfig.handlerCreateWebhook)
+	v1Router.With(apiConfig.middlewareAuth).Get("/webhooks", apiConfig.handlerGetWebhooks)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/webhooks/{webhookId}", apiConfig.handlerDeleteWebhook)
+	v1Router.With(apiConfig.middlewareAuth).Get("/webhooks/{webhookId}/deliveries", apiConfig.handlerGetWebhookDeliveries)
+	v1Router.With(apiConfig.middlewareAuth).Post("/webhooks/{webhookId}/test", apiConfig.handlerTestWebhook)
+	v1Router.With(apiConfig.middlewareAuth).Post("/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver", apiConfig.handlerRedeliverWebhookDelivery)
+	v1Router.With(apiConfig.middlewareAuth).Post("/collections", apiConfig.handlerCreateCollection)
+	v1Router.With(apiConfig.middlewareAuth).Get("/collections", apiConfig.handlerGetCollections)
+	v1Router.Get("/collections/{slug}", apiConfig.handlerGetCollection)
+	v1Router.Get("/collections/{slug}/feed.{format}", apiConfig.handlerGetCollectionFeed)
+	v1Router.With(apiConfig.middlewareAuth).Patch("/collections/{slug}", apiConfig.handlerUpdateCollection)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/collections/{slug}", apiConfig.handlerDeleteCollection)
+	v1Router.With(apiConfig.middlewareAuth).Put("/collections/{slug}/feeds", apiConfig.handlerAddCollectionFeeds)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/collections/{slug}/feeds", apiConfig.handlerRemoveCollectionFeeds)
+	v1Router.With(apiConfig.middlewareAuth).Put("/collections/{slug}/subscription", apiConfig.handlerSubscribeCollection)
+	v1Router.With(apiConfig.middlewareAuth).Delete("/collections/{slug}/subscription", apiConfig.handlerUnsubscribeCollection)
 
 
 	router.Mount("/v1", v1Router)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/darthvadr/rss-aggregator/internal/database"
@@ -11,6 +12,9 @@ type User struct {
 	ID        uuid.UUID `json:"id"`
 	Name      string    `json:"name"`
 	ApiKey    string    `json:"api_key"`
+	// FeedToken authenticates the published timeline at
+	// /v1/users/{id}/feed.{rss,atom,json}?token=
+	FeedToken string    `json:"feed_token"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -23,6 +27,7 @@ func databaseToUser(dbUser database.User) User {
 		CreatedAt: dbUser.CreatedAt.Time,
 		UpdatedAt: dbUser.UpdatedAt.Time,
 		ApiKey: dbUser.ApiKey,
+		FeedToken: dbUser.FeedToken,
 	}
 }
 
@@ -31,14 +36,31 @@ type Feed struct {
 	Title     string    `json:"title"`
 	URL       string    `json:"url"`
 	UserID    uuid.NullUUID `json:"user_id"`
+	FullContent bool    `json:"full_content"`
+	Enabled   bool      `json:"enabled"`
+	PollIntervalMinutes int32 `json:"poll_interval_minutes,omitempty"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CreatedFeed is returned when a feed is added, along with the user's
+// subscription to it when one was requested.
+type CreatedFeed struct {
+	Feed       Feed         `json:"feed"`
+	FeedFollow *FeedFollows `json:"feed_follow,omitempty"`
+	// Existing is set when the feed had already been added before
+	Existing bool `json:"existing"`
+}
+
 type FeedFollows struct {
 	ID        uuid.UUID     `json:"id"`
 	UserID    uuid.NullUUID  `json:"user_id"`
 	FeedID    uuid.NullUUID  `json:"feed_id"`
+	Title     string         `json:"title,omitempty"`
+	FolderID  uuid.NullUUID  `json:"folder_id"`
+	// UnreadCount is only reported when listing feed follows
+	UnreadCount *int64       `json:"unread_count,omitempty"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 }
@@ -46,20 +68,201 @@ type FeedFollows struct {
 type Post struct {
 	ID          uuid.UUID     `json:"id"`
 	URL         string        `json:"url"`
+	CanonicalURL string       `json:"canonical_url"`
 	Title       string        `json:"title"`
 	Description string        `json:"description"`
+	DescriptionText string    `json:"description_text,omitempty"`
+	Content     string        `json:"content,omitempty"`
+	Author      string         `json:"author,omitempty"`
+	Categories  []string       `json:"categories"`
+	Attachments []RSSEnclosure `json:"attachments"`
 	PublishedAt time.Time     `json:"published_at"`
 	CreatedAt   time.Time     `json:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at"`
 	FeedID      uuid.NullUUID  `json:"feed_id"`
+	ClusterID   uuid.NullUUID  `json:"cluster_id"`
+	Read        bool           `json:"read"`
+	ReadAt      *time.Time     `json:"read_at,omitempty"`
+	Starred     bool           `json:"starred"`
+	Tags        []string       `json:"tags"`
+	Sources     []PostSource   `json:"sources,omitempty"`
+}
+
+type Folder struct {
+	ID        uuid.UUID     `json:"id"`
+	ParentID  uuid.NullUUID `json:"parent_id"`
+	Name      string        `json:"name"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// FolderNode is a folder of the folder tree. Its unread count includes the
+// posts of its subfolders.
+type FolderNode struct {
+	Folder
+	UnreadCount int64        `json:"unread_count"`
+	Feeds       []FolderFeed `json:"feeds"`
+	Children    []FolderNode `json:"children,omitempty"`
+}
+
+// FolderFeed is a followed feed as listed in the folder tree.
+type FolderFeed struct {
+	FeedFollowID uuid.UUID     `json:"feed_follow_id"`
+	FeedID       uuid.NullUUID `json:"feed_id"`
+	Title        string        `json:"title"`
+	UnreadCount  int64         `json:"unread_count"`
+}
+
+type Tag struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	PostCount int64     `json:"post_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OPMLImport reports the progress of an OPML import, with the outcome of
+// every feed found in the file.
+type OPMLImport struct {
+	ID         uuid.UUID        `json:"id"`
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	Total      int              `json:"total"`
+	Pending    int              `json:"pending"`
+	Created    int              `json:"created"`
+	Existing   int              `json:"existing"`
+	Failed     int              `json:"failed"`
+	Items      []OPMLImportItem `json:"items"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+type OPMLImportItem struct {
+	URL       string        `json:"url"`
+	Title     string        `json:"title"`
+	Folder    string        `json:"folder,omitempty"`
+	Subfolder string        `json:"subfolder,omitempty"`
+	Status    string        `json:"status"`
+	FeedID    uuid.NullUUID `json:"feed_id"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Collection is a named set of feeds published under a public slug. Feeds is
+// only filled in when a single collection is returned.
+type Collection struct {
+	ID          uuid.UUID `json:"id"`
+	OwnerID     uuid.UUID `json:"owner_id"`
+	Slug        string    `json:"slug"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Feeds       []Feed    `json:"feeds"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CollectionSubscription struct {
+	CollectionID   uuid.UUID `json:"collection_id"`
+	TrackAdditions bool      `json:"track_additions"`
+	// FollowedFeeds is the number of feeds newly followed by subscribing
+	FollowedFeeds int64     `json:"followed_feeds"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Webhook receives the new posts of followed feeds. Secret is only returned
+// when the webhook is created.
+type Webhook struct {
+	ID        uuid.UUID     `json:"id"`
+	URL       string        `json:"url"`
+	Secret    string        `json:"secret,omitempty"`
+	FeedID    uuid.NullUUID `json:"feed_id"`
+	Keywords  []string      `json:"keywords"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// WebhookDelivery is a payload sent to a webhook with the outcome of its
+// last attempt. NextAttemptAt is set while it is pending.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	PostID         uuid.NullUUID   `json:"post_id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	ResponseStatus *int32          `json:"response_status"`
+	Error          string          `json:"error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// FilterRule runs its action on the new posts it matches. FeedFollowID is
+// null for rules applying to every follow.
+type FilterRule struct {
+	ID           uuid.UUID     `json:"id"`
+	FeedFollowID uuid.NullUUID `json:"feed_follow_id"`
+	Name         string        `json:"name"`
+	Field        string        `json:"field"`
+	Keywords     []string      `json:"keywords,omitempty"`
+	Regex        string        `json:"regex,omitempty"`
+	Action       string        `json:"action"`
+	Tag          string        `json:"tag,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// SearchResult is a post matching a search, with the matching passages of its
+// text highlighted with <mark> tags.
+type SearchResult struct {
+	ID          uuid.UUID     `json:"id"`
+	FeedID      uuid.NullUUID `json:"feed_id"`
+	URL         string        `json:"url"`
+	Title       string        `json:"title"`
+	Snippet     string        `json:"snippet"`
+	Rank        float32       `json:"rank"`
+	PublishedAt time.Time     `json:"published_at"`
+}
+
+// StarredPost is the copy of a post saved when it was starred. PostID and
+// FeedID are null once the original post or feed has been deleted.
+type StarredPost struct {
+	ID          uuid.UUID      `json:"id"`
+	PostID      uuid.NullUUID  `json:"post_id"`
+	FeedID      uuid.NullUUID  `json:"feed_id"`
+	FeedTitle   string         `json:"feed_title"`
+	URL         string         `json:"url"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Content     string         `json:"content,omitempty"`
+	Attachments []RSSEnclosure `json:"attachments"`
+	PublishedAt time.Time      `json:"published_at"`
+	StarredAt   time.Time      `json:"starred_at"`
+}
+
+// PostSource is one of the feeds a collapsed story was published in.
+type PostSource struct {
+	PostID    uuid.UUID     `json:"post_id"`
+	FeedID    uuid.NullUUID `json:"feed_id"`
+	FeedTitle string        `json:"feed_title"`
+	URL       string        `json:"url"`
 }
 
 func databaseToFeed(dbFeed database.Feed) Feed {
+	var lastFetchedAt *time.Time
+	if dbFeed.LastFetchedAt.Valid {
+		lastFetchedAt = &dbFeed.LastFetchedAt.Time
+	}
+
 	return Feed{
 		ID:        dbFeed.ID,
 		Title:     dbFeed.Title,
 		URL:       dbFeed.Url,
 		UserID:    dbFeed.UserID,
+		FullContent: dbFeed.FetchFullContent,
+		Enabled:   dbFeed.Enabled,
+		PollIntervalMinutes: dbFeed.PollIntervalMinutes.Int32,
+		LastFetchedAt: lastFetchedAt,
 		CreatedAt: dbFeed.CreatedAt.Time,
 		UpdatedAt: dbFeed.UpdatedAt.Time,
 	}
@@ -80,6 +283,8 @@ func databaseToFeedFollows(dbFeedFollows database.FeedFollow) FeedFollows {
 		ID:        dbFeedFollows.ID,
 		UserID:    dbFeedFollows.UserID,
 		FeedID:    dbFeedFollows.FeedID,
+		Title:     dbFeedFollows.Title.String,
+		FolderID:  dbFeedFollows.FolderID,
 		CreatedAt: dbFeedFollows.CreatedAt.Time,
 		UpdatedAt: dbFeedFollows.UpdatedAt.Time,
 	}
@@ -93,12 +298,94 @@ func databaseFeedFollowsToFeedFollows(dbFeedFollows []database.FeedFollow) []Fee
 	return feedFollows
 }
 
+func databaseToFolder(dbFolder database.Folder) Folder {
+	return Folder{
+		ID:        dbFolder.ID,
+		ParentID:  dbFolder.ParentID,
+		Name:      dbFolder.Name,
+		CreatedAt: dbFolder.CreatedAt.Time,
+		UpdatedAt: dbFolder.UpdatedAt.Time,
+	}
+}
+
+func databaseToOPMLImport(dbImport database.OpmlImport, dbItems []database.OpmlImportItem) OPMLImport {
+	var finishedAt *time.Time
+	if dbImport.FinishedAt.Valid {
+		finishedAt = &dbImport.FinishedAt.Time
+	}
+
+	opmlImport := OPMLImport{
+		ID:         dbImport.ID,
+		Status:     dbImport.Status,
+		Error:      dbImport.Error.String,
+		Total:      len(dbItems),
+		Items:      make([]OPMLImportItem, len(dbItems)),
+		CreatedAt:  dbImport.CreatedAt.Time,
+		FinishedAt: finishedAt,
+	}
+
+	for i, dbItem := range dbItems {
+		switch dbItem.Status {
+		case opmlItemCreated:
+			opmlImport.Created++
+		case opmlItemExisting:
+			opmlImport.Existing++
+		case opmlItemFailed:
+			opmlImport.Failed++
+		default:
+			opmlImport.Pending++
+		}
+
+		opmlImport.Items[i] = OPMLImportItem{
+			URL:       dbItem.Url,
+			Title:     dbItem.Title,
+			Folder:    dbItem.Folder,
+			Subfolder: dbItem.Subfolder,
+			Status:    dbItem.Status,
+			FeedID:    dbItem.FeedID,
+			Error:     dbItem.Error.String,
+		}
+	}
+
+	return opmlImport
+}
+
+func databaseToCollection(dbCollection database.Collection, dbFeeds []database.Feed) Collection {
+	collection := Collection{
+		ID:          dbCollection.ID,
+		OwnerID:     dbCollection.UserID,
+		Slug:        dbCollection.Slug,
+		Name:        dbCollection.Name,
+		Description: dbCollection.Description.String,
+		CreatedAt:   dbCollection.CreatedAt.Time,
+		UpdatedAt:   dbCollection.UpdatedAt.Time,
+		Feeds:       databaseFeedsToFeeds(dbFeeds),
+	}
+	return collection
+}
+
 func databaseToPost(dbPost database.Post) Post {
+	attachments := []RSSEnclosure{}
+	if err := json.Unmarshal(dbPost.Attachments, &attachments); err != nil {
+		attachments = []RSSEnclosure{}
+	}
+
+	categories := dbPost.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+
 	return Post{
 		ID:          dbPost.ID,
 		FeedID:      dbPost.FeedID,
+		ClusterID:   dbPost.ClusterID,
 		Description: dbPost.Description.String,
+		Content:     dbPost.Content.String,
+		Author:      dbPost.Author.String,
+		Categories:  categories,
+		Attachments: attachments,
 		URL:        dbPost.Url,
+		CanonicalURL: dbPost.CanonicalUrl.String,
 		Title:       dbPost.Title,
 		PublishedAt: dbPost.PublishedAt,
 		CreatedAt:   dbPost.CreatedAt.Time,
@@ -113,4 +400,126 @@ func databasePostsToPosts(dbPosts []database.Post) []Post {
 		posts[i] = databaseToPost(dbPost)
 	}
 	return posts
-}
\ No newline at end of file
+}
+func databaseTimelinePostsToPosts(dbPosts []database.TimelinePost) []Post {
+	posts := make([]Post, len(dbPosts))
+	for i, dbPost := range dbPosts {
+		posts[i] = databaseToPost(dbPost.Post)
+		if dbPost.ReadAt.Valid {
+			posts[i].Read = true
+			posts[i].ReadAt = &dbPost.ReadAt.Time
+		}
+		posts[i].Starred = dbPost.Starred
+		posts[i].Tags = dbPost.Tags
+		if posts[i].Tags == nil {
+			posts[i].Tags = []string{}
+		}
+	}
+	return posts
+}
+
+func databaseToStarredPost(dbStarredPost database.StarredPost) StarredPost {
+	attachments := []RSSEnclosure{}
+	if err := json.Unmarshal(dbStarredPost.Attachments, &attachments); err != nil {
+		attachments = []RSSEnclosure{}
+	}
+
+	return StarredPost{
+		ID:          dbStarredPost.ID,
+		PostID:      dbStarredPost.PostID,
+		FeedID:      dbStarredPost.FeedID,
+		FeedTitle:   dbStarredPost.FeedTitle,
+		URL:         dbStarredPost.Url,
+		Title:       dbStarredPost.Title,
+		Description: dbStarredPost.Description.String,
+		Content:     dbStarredPost.Content.String,
+		Attachments: attachments,
+		PublishedAt: dbStarredPost.PublishedAt,
+		StarredAt:   dbStarredPost.CreatedAt.Time,
+	}
+}
+
+func databaseStarredPostsToStarredPosts(dbStarredPosts []database.StarredPost) []StarredPost {
+	starredPosts := make([]StarredPost, len(dbStarredPosts))
+	for i, dbStarredPost := range dbStarredPosts {
+		starredPosts[i] = databaseToStarredPost(dbStarredPost)
+	}
+	return starredPosts
+}
+
+func databaseSearchResultsToSearchResults(dbResults []database.SearchPostsForUserRow) []SearchResult {
+	results := make([]SearchResult, len(dbResults))
+	for i, dbResult := range dbResults {
+		results[i] = SearchResult{
+			ID:          dbResult.ID,
+			FeedID:      dbResult.FeedID,
+			URL:         dbResult.Url,
+			Title:       dbResult.Title,
+			Snippet:     dbResult.Snippet,
+			Rank:        dbResult.Rank,
+			PublishedAt: dbResult.PublishedAt,
+		}
+	}
+	return results
+}
+
+func databaseToWebhook(dbWebhook database.Webhook) Webhook {
+	keywords := dbWebhook.Keywords
+	if keywords == nil {
+		keywords = []string{}
+	}
+
+	return Webhook{
+		ID:        dbWebhook.ID,
+		URL:       dbWebhook.Url,
+		FeedID:    dbWebhook.FeedID,
+		Keywords:  keywords,
+		CreatedAt: dbWebhook.CreatedAt.Time,
+		UpdatedAt: dbWebhook.UpdatedAt.Time,
+	}
+}
+
+func databaseToWebhookDelivery(dbDelivery database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:        dbDelivery.ID,
+		WebhookID: dbDelivery.WebhookID,
+		PostID:    dbDelivery.PostID,
+		Event:     dbDelivery.Event,
+		Status:    dbDelivery.Status,
+		Attempts:  dbDelivery.Attempts,
+		Error:     dbDelivery.Error.String,
+		Payload:   dbDelivery.Payload,
+		CreatedAt: dbDelivery.CreatedAt.Time,
+		UpdatedAt: dbDelivery.UpdatedAt.Time,
+	}
+	if dbDelivery.ResponseStatus.Valid {
+		delivery.ResponseStatus = &dbDelivery.ResponseStatus.Int32
+	}
+	if dbDelivery.Status == webhookStatusPending && dbDelivery.NextAttemptAt.Valid {
+		delivery.NextAttemptAt = &dbDelivery.NextAttemptAt.Time
+	}
+	return delivery
+}
+
+func databaseWebhookDeliveriesToWebhookDeliveries(dbDeliveries []database.WebhookDelivery) []WebhookDelivery {
+	deliveries := make([]WebhookDelivery, len(dbDeliveries))
+	for i, dbDelivery := range dbDeliveries {
+		deliveries[i] = databaseToWebhookDelivery(dbDelivery)
+	}
+	return deliveries
+}
+
+func databaseToFilterRule(dbRule database.FilterRule) FilterRule {
+	return FilterRule{
+		ID:           dbRule.ID,
+		FeedFollowID: dbRule.FeedFollowID,
+		Name:         dbRule.Name,
+		Field:        dbRule.Field,
+		Keywords:     dbRule.Keywords,
+		Regex:        dbRule.Regex.String,
+		Action:       dbRule.Action,
+		Tag:          dbRule.Tag.String,
+		CreatedAt:    dbRule.CreatedAt.Time,
+		UpdatedAt:    dbRule.UpdatedAt.Time,
+	}
+}
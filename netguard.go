@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// errNonPublicAddress is returned for hosts on loopback, private, link-local
+// or otherwise reserved addresses.
+var errNonPublicAddress = errors.New("address is not public")
+
+// reservedNetworks are the non-public ranges the net.IP methods don't cover.
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved, and broadcast
+	"64:ff9b:1::/48", // local-use NAT64
+	"2001:db8::/32",  // documentation
+)
+
+// addressGuard keeps the requests users can point somewhere (feeds, webhooks)
+// from reaching the server's own network. It is checked when the URL is
+// given and again on every connection, after DNS resolution, so a name
+// re-pointed at an internal address later is still refused.
+type addressGuard struct {
+	// allowPrivate turns the guard off, for deployments reaching feeds or
+	// webhooks on their own network
+	allowPrivate bool
+}
+
+// control is a net.Dialer Control hook refusing connections to non-public
+// addresses.
+func (g addressGuard) control(network, address string, _ syscall.RawConn) error {
+	if g.allowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", errNonPublicAddress, host)
+	}
+	return nil
+}
+
+// transport returns an HTTP transport whose connections go through the guard.
+func (g addressGuard) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   g.control,
+	}
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// checkHost resolves host and returns errNonPublicAddress when any of its
+// addresses isn't public.
+func (g addressGuard) checkHost(ctx context.Context, host string) error {
+	if g.allowPrivate {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return errNonPublicAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return errNonPublicAddress
+		}
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
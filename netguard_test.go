@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestAddressGuard(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{ip: "93.184.215.14", public: true},
+		{ip: "2606:2800:21f:cb07:6820:80da:af6b:8b2c", public: true},
+		{ip: "127.0.0.1", public: false},
+		{ip: "::1", public: false},
+		{ip: "10.1.2.3", public: false},
+		{ip: "172.16.0.1", public: false},
+		{ip: "192.168.1.1", public: false},
+		{ip: "fd00::1", public: false},
+		{ip: "169.254.169.254", public: false},
+		{ip: "fe80::1", public: false},
+		{ip: "0.0.0.0", public: false},
+		{ip: "::", public: false},
+		{ip: "100.64.0.1", public: false},
+		{ip: "::ffff:127.0.0.1", public: false},
+		{ip: "::ffff:10.0.0.1", public: false},
+		{ip: "224.0.0.1", public: false},
+		{ip: "255.255.255.255", public: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			guard := addressGuard{}
+
+			err := guard.control("tcp", net.JoinHostPort(tt.ip, "443"), nil)
+			if public := err == nil; public != tt.public {
+				t.Errorf("control() error = %v, want public = %v", err, tt.public)
+			}
+			if err != nil && !errors.Is(err, errNonPublicAddress) {
+				t.Errorf("control() error = %v, want errNonPublicAddress", err)
+			}
+
+			err = guard.checkHost(context.Background(), tt.ip)
+			if public := err == nil; public != tt.public {
+				t.Errorf("checkHost() error = %v, want public = %v", err, tt.public)
+			}
+
+			allowed := addressGuard{allowPrivate: true}
+			if err := allowed.control("tcp", net.JoinHostPort(tt.ip, "443"), nil); err != nil {
+				t.Errorf("control() with private addresses allowed error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"golang.org/x/net/html/charset"
+)
+
+// maxOPMLSize bounds the OPML files accepted for import.
+const maxOPMLSize = 5 << 20
+
+// opmlImportConcurrency is how many feeds of an import are checked and
+// followed at the same time.
+const opmlImportConcurrency = 4
+
+// Imports are running until every item has been handled, then done. Items
+// start out pending.
+const (
+	opmlStatusDone = "done"
+
+	opmlItemCreated  = "created"
+	opmlItemExisting = "existing"
+	opmlItemFailed   = "failed"
+)
+
+var errNotOPML = errors.New("document is not an OPML file")
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+	OwnerName   string `xml:"ownerName,omitempty"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlOutline is either a feed, when it has an xmlUrl, or a folder holding
+// more outlines.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlEntry is a feed found in an OPML file with the folders it sits in.
+type opmlEntry struct {
+	URL       string
+	Title     string
+	Folder    string
+	Subfolder string
+}
+
+func parseOPML(r io.Reader) (opmlDocument, error) {
+	var doc opmlDocument
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(&doc); err != nil {
+		var syntaxErr *xml.SyntaxError
+		var unmarshalErr xml.UnmarshalError
+		if errors.As(err, &syntaxErr) || errors.As(err, &unmarshalErr) || errors.Is(err, io.EOF) {
+			return doc, fmt.Errorf("%w: %v", errNotOPML, err)
+		}
+		return doc, err
+	}
+	return doc, nil
+}
+
+// entries lists the feeds of the document in order, once per URL. Folders
+// only nest one level deep, outlines nested further are put in the folder of
+// their second level ancestor.
+func (doc opmlDocument) entries() []opmlEntry {
+	var entries []opmlEntry
+	seen := map[string]bool{}
+
+	var walk func(outlines []opmlOutline, path []string)
+	walk = func(outlines []opmlOutline, path []string) {
+		for _, outline := range outlines {
+			title := strings.TrimSpace(outline.Title)
+			if title == "" {
+				title = strings.TrimSpace(outline.Text)
+			}
+
+			if feedURL := strings.TrimSpace(outline.XMLURL); feedURL != "" && !seen[feedURL] {
+				seen[feedURL] = true
+				entry := opmlEntry{URL: feedURL, Title: title}
+				if len(path) > 0 {
+					entry.Folder = path[0]
+				}
+				if len(path) > 1 {
+					entry.Subfolder = path[1]
+				}
+				entries = append(entries, entry)
+			}
+
+			if len(outline.Outlines) > 0 {
+				childPath := path
+				if outline.XMLURL == "" && title != "" {
+					childPath = append(append([]string{}, path...), title)
+				}
+				walk(outline.Outlines, childPath)
+			}
+		}
+	}
+	walk(doc.Body.Outlines, nil)
+
+	return entries
+}
+
+// buildOPML lays out a user's follows as an OPML 2.0 document, inside their
+// folders. Folders come first, then the feeds in no folder.
+func buildOPML(ownerName string, created time.Time, folders []database.Folder, follows []database.GetFeedFollowsWithFeedsRow) opmlDocument {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       "RSS Aggregator subscriptions",
+			DateCreated: created.UTC().Format(time.RFC1123Z),
+			OwnerName:   ownerName,
+		},
+	}
+
+	feedsByFolder := map[uuid.UUID][]opmlOutline{}
+	var unfiled []opmlOutline
+	for _, follow := range follows {
+		title := follow.FeedTitle
+		if follow.Title.Valid {
+			title = follow.Title.String
+		}
+		outline := opmlOutline{Text: title, Title: title, Type: "rss", XMLURL: follow.FeedUrl}
+
+		if follow.FolderID.Valid {
+			feedsByFolder[follow.FolderID.UUID] = append(feedsByFolder[follow.FolderID.UUID], outline)
+		} else {
+			unfiled = append(unfiled, outline)
+		}
+	}
+
+	folderOutline := func(folder database.Folder) opmlOutline {
+		return opmlOutline{Text: folder.Name, Title: folder.Name}
+	}
+
+	topLevel := map[uuid.UUID]int{}
+	for _, folder := range folders {
+		if !folder.ParentID.Valid {
+			topLevel[folder.ID] = len(doc.Body.Outlines)
+			doc.Body.Outlines = append(doc.Body.Outlines, folderOutline(folder))
+		}
+	}
+	// Subfolders go before the feeds of their parent folder
+	for _, folder := range folders {
+		if i, ok := topLevel[folder.ParentID.UUID]; ok && folder.ParentID.Valid {
+			subfolder := folderOutline(folder)
+			subfolder.Outlines = feedsByFolder[folder.ID]
+			doc.Body.Outlines[i].Outlines = append(doc.Body.Outlines[i].Outlines, subfolder)
+		}
+	}
+	for id, i := range topLevel {
+		doc.Body.Outlines[i].Outlines = append(doc.Body.Outlines[i].Outlines, feedsByFolder[id]...)
+	}
+
+	doc.Body.Outlines = append(doc.Body.Outlines, unfiled...)
+	return doc
+}
+
+// runOPMLImport follows the feeds of an import and records the outcome of
+// each item. It runs after the request that started the import has been
+// answered.
+func (apiConfig *apiConfig) runOPMLImport(userID, importID uuid.UUID, items []database.OpmlImportItem) {
+	ctx := context.Background()
+
+	// Folders are created up front, workers importing feeds of the same
+	// folder would otherwise race to create it
+	folders := map[[2]string]uuid.NullUUID{}
+	folderErrors := map[[2]string]error{}
+	for _, item := range items {
+		key := [2]string{item.Folder, item.Subfolder}
+		if _, ok := folders[key]; ok || item.Folder == "" {
+			continue
+		}
+		folderID, err := apiConfig.opmlFolder(ctx, userID, item.Folder, item.Subfolder)
+		if err != nil {
+			log.Println("Error creating folder for OPML import: ", fmt.Errorf("error creating folder %q: %w", item.Folder, err))
+			folderErrors[key] = err
+		}
+		folders[key] = folderID
+	}
+
+	work := make(chan database.OpmlImportItem)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < opmlImportConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				key := [2]string{item.Folder, item.Subfolder}
+				update := database.UpdateOPMLImportItemParams{ID: item.ID}
+
+				if err := folderErrors[key]; err != nil {
+					update.Status = opmlItemFailed
+					update.Error = sql.NullString{String: "could not create folder", Valid: true}
+				} else {
+					status, feedID, err := apiConfig.importOPMLItem(ctx, userID, item, folders[key])
+					update.Status, update.FeedID = status, feedID
+					if err != nil {
+						update.Error = sql.NullString{String: err.Error(), Valid: true}
+					}
+				}
+
+				if err := apiConfig.DB.UpdateOPMLImportItem(ctx, update); err != nil {
+					log.Println("Error updating OPML import item: ", fmt.Errorf("error updating OPML import item: %w", err))
+				}
+			}
+		}()
+	}
+
+	for _, item := range items {
+		work <- item
+	}
+	close(work)
+	wg.Wait()
+
+	if err := apiConfig.DB.FinishOPMLImport(ctx, database.FinishOPMLImportParams{
+		ID:     importID,
+		Status: opmlStatusDone,
+	}); err != nil {
+		log.Println("Error finishing OPML import: ", fmt.Errorf("error finishing OPML import: %w", err))
+	}
+}
+
+// importOPMLItem follows the feed of an import item, adding it first when
+// nobody has yet. Errors are meant for the import report.
+func (apiConfig *apiConfig) importOPMLItem(ctx context.Context, userID uuid.UUID, item database.OpmlImportItem, folderID uuid.NullUUID) (string, uuid.NullUUID, error) {
+	if validationErr := validateFeedURL(item.Url); validationErr != nil {
+		return opmlItemFailed, uuid.NullUUID{}, errors.New(validationErr.Message)
+	}
+
+	feedURL, title := item.Url, item.Title
+	if _, err := apiConfig.DB.GetFeedByURL(ctx, feedURL); err != nil {
+		candidate, rssFeed, validationErr := testFetchFeed(ctx, apiConfig.Fetcher, item.Url)
+		if validationErr != nil {
+			return opmlItemFailed, uuid.NullUUID{}, errors.New(validationErr.Message)
+		}
+
+		feedURL = candidate.URL
+		if title == "" {
+			title = rssFeed.Channel.Title
+		}
+	}
+
+	createdFeed, err := apiConfig.createFeed(ctx, userID, database.CreateFeedParams{
+		ID:     uuid.New(),
+		Title:  title,
+		Url:    feedURL,
+		UserID: uuid.NullUUID{UUID: userID, Valid: true},
+	}, true)
+	if err != nil {
+		log.Println("Error creating feed for OPML import: ", fmt.Errorf("error creating feed: %w", err))
+		return opmlItemFailed, uuid.NullUUID{}, errors.New("could not add the feed")
+	}
+	feedID := uuid.NullUUID{UUID: createdFeed.Feed.ID, Valid: true}
+
+	if folderID.Valid && createdFeed.FeedFollow != nil {
+		if _, err := apiConfig.DB.MoveFeedFollowsToFolder(ctx, database.MoveFeedFollowsToFolderParams{
+			UserID:   uuid.NullUUID{UUID: userID, Valid: true},
+			FolderID: folderID,
+			Ids:      []uuid.UUID{createdFeed.FeedFollow.ID},
+		}); err != nil {
+			log.Println("Error moving feed follow for OPML import: ", fmt.Errorf("error moving feed follow: %w", err))
+			return opmlItemFailed, feedID, errors.New("feed followed but could not be put in its folder")
+		}
+	}
+
+	if createdFeed.Existing {
+		return opmlItemExisting, feedID, nil
+	}
+	return opmlItemCreated, feedID, nil
+}
+
+// opmlFolder returns the user's folder at folder/subfolder, creating the
+// missing ones.
+func (apiConfig *apiConfig) opmlFolder(ctx context.Context, userID uuid.UUID, folder, subfolder string) (uuid.NullUUID, error) {
+	folderID, err := apiConfig.findOrCreateFolder(ctx, userID, uuid.NullUUID{}, folder)
+	if err != nil || subfolder == "" {
+		return folderID, err
+	}
+	return apiConfig.findOrCreateFolder(ctx, userID, folderID, subfolder)
+}
+
+func (apiConfig *apiConfig) findOrCreateFolder(ctx context.Context, userID uuid.UUID, parentID uuid.NullUUID, name string) (uuid.NullUUID, error) {
+	folder, err := apiConfig.DB.GetFolderByName(ctx, database.GetFolderByNameParams{
+		UserID:   userID,
+		ParentID: parentID,
+		Name:     name,
+	})
+	if err == nil {
+		return uuid.NullUUID{UUID: folder.ID, Valid: true}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.NullUUID{}, err
+	}
+
+	folder, err = apiConfig.DB.CreateFolder(ctx, database.CreateFolderParams{
+		ID:       uuid.New(),
+		UserID:   userID,
+		ParentID: parentID,
+		Name:     name,
+	})
+	// Created in the meantime by the user
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return apiConfig.findOrCreateFolder(ctx, userID, parentID, name)
+	}
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: folder.ID, Valid: true}, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestParseOPML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []opmlEntry
+		wantErr error
+	}{
+		{
+			name: "flat",
+			input: `<opml version="2.0"><body>
+				<outline text="Go" type="rss" xmlUrl="https://go.dev/blog/feed.atom"/>
+				<outline text="Rust" title="Rust Blog" type="rss" xmlUrl=" https://blog.rust-lang.org/feed.xml "/>
+			</body></opml>`,
+			want: []opmlEntry{
+				{URL: "https://go.dev/blog/feed.atom", Title: "Go"},
+				{URL: "https://blog.rust-lang.org/feed.xml", Title: "Rust Blog"},
+			},
+		},
+		{
+			name: "nested folders",
+			input: `<opml version="1.0"><body>
+				<outline text="Tech">
+					<outline text="Go" xmlUrl="https://go.dev/blog/feed.atom"/>
+					<outline text="Languages">
+						<outline text="Rust" xmlUrl="https://blog.rust-lang.org/feed.xml"/>
+						<outline text="Old">
+							<outline text="Perl" xmlUrl="https://perl.com/feed"/>
+						</outline>
+					</outline>
+				</outline>
+				<outline text="News" xmlUrl="https://news.example.com/rss"/>
+			</body></opml>`,
+			want: []opmlEntry{
+				{URL: "https://go.dev/blog/feed.atom", Title: "Go", Folder: "Tech"},
+				{URL: "https://blog.rust-lang.org/feed.xml", Title: "Rust", Folder: "Tech", Subfolder: "Languages"},
+				{URL: "https://perl.com/feed", Title: "Perl", Folder: "Tech", Subfolder: "Languages"},
+				{URL: "https://news.example.com/rss", Title: "News"},
+			},
+		},
+		{
+			name: "duplicate feeds listed once",
+			input: `<opml version="2.0"><body>
+				<outline text="Go" xmlUrl="https://go.dev/blog/feed.atom"/>
+				<outline text="Tech"><outline text="Go again" xmlUrl="https://go.dev/blog/feed.atom"/></outline>
+			</body></opml>`,
+			want: []opmlEntry{{URL: "https://go.dev/blog/feed.atom", Title: "Go"}},
+		},
+		{
+			name:  "non utf-8 charset",
+			input: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><opml version=\"2.0\"><body><outline text=\"Caf\xe9\" xmlUrl=\"https://cafe.example.com/feed\"/></body></opml>",
+			want:  []opmlEntry{{URL: "https://cafe.example.com/feed", Title: "Café"}},
+		},
+		{name: "html document", input: `<html><body><p>hi</p></body></html>`, wantErr: errNotOPML},
+		{name: "malformed xml", input: `<opml><body><outline`, wantErr: errNotOPML},
+		{name: "empty", input: ``, wantErr: errNotOPML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseOPML(strings.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseOPML() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := doc.entries(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildOPML(t *testing.T) {
+	tech := database.Folder{ID: uuid.New(), Name: "Tech"}
+	languages := database.Folder{ID: uuid.New(), Name: "Languages", ParentID: uuid.NullUUID{UUID: tech.ID, Valid: true}}
+	empty := database.Folder{ID: uuid.New(), Name: "Empty"}
+
+	follow := func(title, url string, folder *database.Folder) database.GetFeedFollowsWithFeedsRow {
+		row := database.GetFeedFollowsWithFeedsRow{ID: uuid.New(), FeedTitle: title, FeedUrl: url}
+		if folder != nil {
+			row.FolderID = uuid.NullUUID{UUID: folder.ID, Valid: true}
+		}
+		return row
+	}
+	renamed := follow("Go Blog", "https://go.dev/blog/feed.atom", &tech)
+	renamed.Title = sql.NullString{String: "Go", Valid: true}
+
+	tests := []struct {
+		name    string
+		folders []database.Folder
+		follows []database.GetFeedFollowsWithFeedsRow
+		want    []opmlEntry
+	}{
+		{
+			name:    "no folders",
+			follows: []database.GetFeedFollowsWithFeedsRow{follow("News", "https://news.example.com/rss", nil)},
+			want:    []opmlEntry{{URL: "https://news.example.com/rss", Title: "News"}},
+		},
+		{
+			name:    "nested folders",
+			folders: []database.Folder{tech, languages, empty},
+			follows: []database.GetFeedFollowsWithFeedsRow{
+				follow("News", "https://news.example.com/rss", nil),
+				renamed,
+				follow("Rust", "https://blog.rust-lang.org/feed.xml", &languages),
+			},
+			// Subfolders come before the feeds of their parent, unfiled
+			// feeds last
+			want: []opmlEntry{
+				{URL: "https://blog.rust-lang.org/feed.xml", Title: "Rust", Folder: "Tech", Subfolder: "Languages"},
+				{URL: "https://go.dev/blog/feed.atom", Title: "Go", Folder: "Tech"},
+				{URL: "https://news.example.com/rss", Title: "News"},
+			},
+		},
+	}
+
+	created := time.Date(2024, 7, 25, 10, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := buildOPML("alice", created, tt.folders, tt.follows)
+			if doc.Version != "2.0" || doc.Head.OwnerName != "alice" || doc.Head.DateCreated != "Thu, 25 Jul 2024 10:00:00 +0000" {
+				t.Errorf("head = %+v, version %q", doc.Head, doc.Version)
+			}
+
+			// Exported files must import back the same
+			encoded, err := xml.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := parseOPML(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("parseOPML() error = %v", err)
+			}
+			if got := parsed.entries(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
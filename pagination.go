@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultPageLimit = 20
+const maxPageLimit = 100
+
+// pageCursor points at a row of a list sorted by (time, id). It is handed to
+// clients as an opaque string.
+type pageCursor struct {
+	Time time.Time
+	ID   uuid.UUID
+}
+
+func (c pageCursor) String() string {
+	raw := c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parsePageCursor(value string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return &pageCursor{Time: t, ID: id}, nil
+}
+
+// pageParams are the limit, before and after query parameters shared by every
+// list endpoint. Lists are sorted newest first unless the endpoint lets the
+// client pick an order: before returns the rows that come after the cursor in
+// list order, after the rows that come before it.
+type pageParams struct {
+	Limit  int32
+	Before *pageCursor
+	After  *pageCursor
+}
+
+func (p pageParams) beforeTime() sql.NullTime {
+	if p.Before == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: p.Before.Time, Valid: true}
+}
+
+func (p pageParams) beforeID() uuid.NullUUID {
+	if p.Before == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: p.Before.ID, Valid: true}
+}
+
+func parsePageParams(r *http.Request) (pageParams, error) {
+	query := r.URL.Query()
+	params := pageParams{Limit: defaultPageLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			return pageParams{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		params.Limit = int32(parsed)
+	}
+
+	if query.Get("before") != "" && query.Get("after") != "" {
+		return pageParams{}, errors.New("before and after can't be used together")
+	}
+
+	var err error
+	if before := query.Get("before"); before != "" {
+		if params.Before, err = parsePageCursor(before); err != nil {
+			return pageParams{}, fmt.Errorf("invalid before: %w", err)
+		}
+	}
+	if after := query.Get("after"); after != "" {
+		if params.After, err = parsePageCursor(after); err != nil {
+			return pageParams{}, fmt.Errorf("invalid after: %w", err)
+		}
+	}
+
+	return params, nil
+}
+
+// paginate trims the extra row fetched to detect further pages, restores the
+// list order of rows fetched with an after cursor, and sets the Link header
+// pointing at the neighbouring pages. Queries are expected to fetch Limit+1
+// rows, in reverse list order when After is set.
+func paginate[T any](w http.ResponseWriter, r *http.Request, params pageParams, rows []T, cursor func(T) pageCursor) []T {
+	hasMore := len(rows) > int(params.Limit)
+	if hasMore {
+		rows = rows[:params.Limit]
+	}
+
+	if params.After != nil {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	var links []string
+	link := func(rel string, key string, c pageCursor) {
+		u := *r.URL
+		query := u.Query()
+		query.Del("before")
+		query.Del("after")
+		query.Set(key, c.String())
+		u.RawQuery = query.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel))
+	}
+
+	if len(rows) > 0 {
+		first, last := cursor(rows[0]), cursor(rows[len(rows)-1])
+
+		// Older rows exist when more were fetched than shown, or when paging
+		// with after since the cursor itself is older
+		if hasMore || params.After != nil {
+			link("next", "before", last)
+		}
+		// Newer rows exist when paging with before, or when paging with after
+		// returned more than a page
+		if params.Before != nil || (params.After != nil && hasMore) {
+			link("prev", "after", first)
+		}
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return rows
+}
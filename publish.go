@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultPublishedFeedLimit = 50
+
+// The aggregated timeline of a user is published in the three formats feed
+// readers understand. publishedFeed holds what they have in common.
+type publishedFeed struct {
+	// ID stays the same when the URL changes with a new token
+	ID      string
+	Title   string
+	HomeURL string
+	SelfURL string
+	Updated time.Time
+	Posts   []Post
+}
+
+const (
+	rssContentType      = "application/rss+xml; charset=utf-8"
+	atomContentType     = "application/atom+xml; charset=utf-8"
+	jsonFeedContentType = "application/feed+json; charset=utf-8"
+)
+
+type rssOutput struct {
+	XMLName xml.Name         `xml:"rss"`
+	Version string           `xml:"version,attr"`
+	Atom    string           `xml:"xmlns:atom,attr"`
+	Content string           `xml:"xmlns:content,attr"`
+	Channel rssOutputChannel `xml:"channel"`
+}
+
+type rssOutputChannel struct {
+	Title         string          `xml:"title"`
+	Link          string          `xml:"link"`
+	Description   string          `xml:"description"`
+	LastBuildDate string          `xml:"lastBuildDate"`
+	AtomLink      atomOutputLink  `xml:"atom:link"`
+	Items         []rssOutputItem `xml:"item"`
+}
+
+type rssOutputItem struct {
+	Title       string               `xml:"title"`
+	Link        string               `xml:"link"`
+	GUID        rssOutputGUID        `xml:"guid"`
+	PubDate     string               `xml:"pubDate"`
+	Description string               `xml:"description,omitempty"`
+	Content     *rssOutputCDATA      `xml:"content:encoded,omitempty"`
+	Enclosures  []rssOutputEnclosure `xml:"enclosure"`
+}
+
+type rssOutputGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssOutputCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+type rssOutputEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomOutput struct {
+	XMLName xml.Name          `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string            `xml:"id"`
+	Title   string            `xml:"title"`
+	Updated string            `xml:"updated"`
+	Links   []atomOutputLink  `xml:"link"`
+	Entries []atomOutputEntry `xml:"entry"`
+}
+
+type atomOutputLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomOutputEntry struct {
+	ID        string           `xml:"id"`
+	Title     string           `xml:"title"`
+	Links     []atomOutputLink `xml:"link"`
+	Published string           `xml:"published"`
+	Updated   string           `xml:"updated"`
+	Summary   *atomOutputText  `xml:"summary,omitempty"`
+	Content   *atomOutputText  `xml:"content,omitempty"`
+}
+
+type atomOutputText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// jsonFeedOutput follows https://www.jsonfeed.org/version/1.1/
+type jsonFeedOutput struct {
+	Version     string               `json:"version"`
+	Title       string               `json:"title"`
+	HomePageURL string               `json:"home_page_url,omitempty"`
+	FeedURL     string               `json:"feed_url"`
+	Items       []jsonFeedOutputItem `json:"items"`
+}
+
+type jsonFeedOutputItem struct {
+	ID            string                     `json:"id"`
+	URL           string                     `json:"url"`
+	Title         string                     `json:"title"`
+	ContentHTML   string                     `json:"content_html"`
+	Summary       string                     `json:"summary,omitempty"`
+	DatePublished string                     `json:"date_published"`
+	DateModified  string                     `json:"date_modified,omitempty"`
+	Attachments   []jsonFeedOutputAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedOutputAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+// postID is the stable identifier of a published post. Post URLs are not
+// unique across feeds, the post's own ID is.
+func postID(post Post) string {
+	return "urn:uuid:" + post.ID.String()
+}
+
+func (feed publishedFeed) rss() ([]byte, error) {
+	output := rssOutput{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Content: "http://purl.org/rss/1.0/modules/content/",
+		Channel: rssOutputChannel{
+			Title:         feed.Title,
+			Link:          feed.HomeURL,
+			Description:   feed.Title,
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+			AtomLink:      atomOutputLink{Href: feed.SelfURL, Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssOutputItem, len(feed.Posts)),
+		},
+	}
+
+	for i, post := range feed.Posts {
+		item := rssOutputItem{
+			Title:       post.Title,
+			Link:        post.URL,
+			GUID:        rssOutputGUID{Value: postID(post)},
+			PubDate:     post.PublishedAt.UTC().Format(time.RFC1123Z),
+			Description: post.Description,
+		}
+		if post.Content != "" {
+			item.Content = &rssOutputCDATA{Value: post.Content}
+		}
+		for _, attachment := range post.Attachments {
+			item.Enclosures = append(item.Enclosures, rssOutputEnclosure(attachment))
+		}
+		output.Channel.Items[i] = item
+	}
+
+	return marshalXMLDocument(output)
+}
+
+func (feed publishedFeed) atom() ([]byte, error) {
+	output := atomOutput{
+		ID:      feed.ID,
+		Title:   feed.Title,
+		Updated: feed.Updated.UTC().Format(time.RFC3339),
+		Links: []atomOutputLink{
+			{Href: feed.SelfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: feed.HomeURL, Rel: "alternate"},
+		},
+		Entries: make([]atomOutputEntry, len(feed.Posts)),
+	}
+
+	for i, post := range feed.Posts {
+		entry := atomOutputEntry{
+			ID:        postID(post),
+			Title:     post.Title,
+			Links:     []atomOutputLink{{Href: post.URL, Rel: "alternate"}},
+			Published: post.PublishedAt.UTC().Format(time.RFC3339),
+			Updated:   post.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		if post.Description != "" {
+			entry.Summary = &atomOutputText{Type: "html", Value: post.Description}
+		}
+		if post.Content != "" {
+			entry.Content = &atomOutputText{Type: "html", Value: post.Content}
+		}
+		for _, attachment := range post.Attachments {
+			entry.Links = append(entry.Links, atomOutputLink{
+				Href:   attachment.URL,
+				Rel:    "enclosure",
+				Type:   attachment.Type,
+				Length: attachment.Length,
+			})
+		}
+		output.Entries[i] = entry
+	}
+
+	return marshalXMLDocument(output)
+}
+
+func (feed publishedFeed) jsonFeed() ([]byte, error) {
+	output := jsonFeedOutput{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.HomeURL,
+		FeedURL:     feed.SelfURL,
+		Items:       make([]jsonFeedOutputItem, len(feed.Posts)),
+	}
+
+	for i, post := range feed.Posts {
+		item := jsonFeedOutputItem{
+			ID:            postID(post),
+			URL:           post.URL,
+			Title:         post.Title,
+			ContentHTML:   post.Description,
+			DatePublished: post.PublishedAt.UTC().Format(time.RFC3339),
+			DateModified:  post.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		if post.Content != "" {
+			item.ContentHTML = post.Content
+			item.Summary = htmlToText(post.Description)
+		}
+		for _, attachment := range post.Attachments {
+			size, _ := strconv.ParseInt(attachment.Length, 10, 64)
+			item.Attachments = append(item.Attachments, jsonFeedOutputAttachment{
+				URL:         attachment.URL,
+				MimeType:    attachment.Type,
+				SizeInBytes: size,
+			})
+		}
+		output.Items[i] = item
+	}
+
+	return json.Marshal(output)
+}
+
+// render encodes the feed in one of the published formats, rss, atom or
+// json, and returns it with its content type.
+func (feed publishedFeed) render(format string) ([]byte, string, error) {
+	switch format {
+	case "rss":
+		payload, err := feed.rss()
+		return payload, rssContentType, err
+	case "atom":
+		payload, err := feed.atom()
+		return payload, atomContentType, err
+	case "json":
+		payload, err := feed.jsonFeed()
+		return payload, jsonFeedContentType, err
+	}
+	return nil, "", errUnknownFeedFormat
+}
+
+var errUnknownFeedFormat = errors.New("feed format must be rss, atom or json")
+
+func isFeedFormat(format string) bool {
+	return format == "rss" || format == "atom" || format == "json"
+}
+
+// publishedFeedLimit reads how many posts a published feed holds.
+func publishedFeedLimit(r *http.Request) (int32, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultPublishedFeedLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	return int32(limit), nil
+}
+
+// requestBaseURL is the scheme and host the request was sent to, ending with
+// a slash.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/"
+}
+
+func writePublishedFeed(w http.ResponseWriter, format string, feed publishedFeed) {
+	payload, contentType, err := feed.render(format)
+	if err != nil {
+		log.Println("Error rendering feed: ", fmt.Errorf("error rendering %s feed: %w", format, err))
+		responseWithError(w, http.StatusInternalServerError, "error rendering feed")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+func marshalXMLDocument(v interface{}) ([]byte, error) {
+	payload, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), payload...), nil
+}
@@ -1,42 +1,70 @@
 package main
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"log"
-	"net/http"
-	"time"
 )
 
+var errFeedUnreachable = errors.New("feed unreachable")
+var errNotAFeed = errors.New("not an RSS feed")
+
 type RSSFeed struct {
+	XMLName xml.Name
+	Base string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Language    string    `xml:"language"`
-		Items       []RSSItem `xml:"item"`
+		Base string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+		// AtomLinks must be declared before Link so that <atom:link> elements
+		// don't overwrite the channel's own <link> value.
+		AtomLinks   []RSSAtomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Title       string        `xml:"title"`
+		Link        string        `xml:"link"`
+		Description string        `xml:"description"`
+		Language    string        `xml:"language"`
+		Items       []RSSItem     `xml:"item"`
 	} `xml:"channel"`
-	
-	
+
+	// FetchURL is the URL the feed was finally served from, after redirects.
+	FetchURL string `xml:"-"`
+}
+
+type RSSAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
 }
 
 type RSSItem struct {
+	Base        string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+	// Author is an email address, feeds more often name the author with
+	// dc:creator
+	Author     string   `xml:"author"`
+	Creator    string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories []string `xml:"category"`
 }
 
-func urlToFeed(url string) (RSSFeed, error) {
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr" json:"url"`
+	Type   string `xml:"type,attr" json:"type,omitempty"`
+	Length string `xml:"length,attr" json:"length,omitempty"`
+}
 
-	httpClient := http.Client{
-		Timeout:  10 * time.Second,
-	}
+// urlToFeed fetches and parses the RSS feed at url. Errors wrap
+// errFeedUnreachable when the feed couldn't be downloaded and errNotAFeed when
+// what was downloaded isn't an RSS feed.
+func urlToFeed(ctx context.Context, client *fetcher, url string) (RSSFeed, error) {
 
-	resp, err := httpClient.Get(url)
+	resp, err := client.get(ctx, url)
 	if err != nil {
 		log.Println("Error fetching RSS feed: ", err)
-		return RSSFeed{}, err
+		return RSSFeed{}, fmt.Errorf("%w: %w", errFeedUnreachable, err)
 
 	}
 	defer resp.Body.Close()
@@ -44,8 +72,15 @@ func urlToFeed(url string) (RSSFeed, error) {
 	var rssFeed RSSFeed
 	if err := xml.NewDecoder(resp.Body).Decode(&rssFeed); err != nil {
 		log.Println("Error decoding RSS feed: ", err)
-		return RSSFeed{}, err
+		return RSSFeed{}, fmt.Errorf("%w: %v", errNotAFeed, err)
+	}
+
+	if rssFeed.XMLName.Local != "rss" {
+		return RSSFeed{}, fmt.Errorf("%w: unexpected root element <%s>", errNotAFeed, rssFeed.XMLName.Local)
 	}
 
+	rssFeed.FetchURL = resp.Request.URL.String()
+	resolveFeedURLs(&rssFeed)
+
 	return rssFeed, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// The parts of a post a filter rule looks at. any is all of them.
+const (
+	ruleFieldTitle    = "title"
+	ruleFieldContent  = "content"
+	ruleFieldAuthor   = "author"
+	ruleFieldCategory = "category"
+	ruleFieldAny      = "any"
+)
+
+// What a filter rule does to the posts it matches, for its user.
+const (
+	ruleActionHide     = "hide"
+	ruleActionMarkRead = "mark_read"
+	ruleActionStar     = "star"
+	ruleActionTag      = "tag"
+)
+
+var ruleFields = map[string]bool{
+	ruleFieldTitle:    true,
+	ruleFieldContent:  true,
+	ruleFieldAuthor:   true,
+	ruleFieldCategory: true,
+	ruleFieldAny:      true,
+}
+
+var ruleActions = map[string]bool{
+	ruleActionHide:     true,
+	ruleActionMarkRead: true,
+	ruleActionStar:     true,
+	ruleActionTag:      true,
+}
+
+// filterRule is a rule ready to be evaluated against posts.
+type filterRule struct {
+	database.FilterRule
+	regex *regexp.Regexp
+	// keywords are lowercased
+	keywords []string
+}
+
+func compileFilterRule(rule database.FilterRule) (filterRule, error) {
+	compiled := filterRule{FilterRule: rule}
+	if rule.Regex.Valid {
+		regex, err := regexp.Compile(rule.Regex.String)
+		if err != nil {
+			return compiled, fmt.Errorf("invalid regex: %w", err)
+		}
+		compiled.regex = regex
+	}
+	for _, keyword := range rule.Keywords {
+		compiled.keywords = append(compiled.keywords, strings.ToLower(keyword))
+	}
+	return compiled, nil
+}
+
+// matches reports whether the rule's field of the post matches. Keywords match
+// anywhere in the text regardless of case, regexes are case sensitive unless
+// they start with (?i). Categories are matched one at a time.
+func (rule filterRule) matches(post database.Post) bool {
+	for _, text := range ruleFieldValues(rule.Field, post) {
+		if rule.matchesText(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule filterRule) matchesText(text string) bool {
+	if rule.regex != nil {
+		return rule.regex.MatchString(text)
+	}
+
+	text = strings.ToLower(text)
+	for _, keyword := range rule.keywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleFieldValues(field string, post database.Post) []string {
+	content := htmlToText(post.Description.String + " " + post.Content.String)
+
+	switch field {
+	case ruleFieldTitle:
+		return []string{post.Title}
+	case ruleFieldContent:
+		return []string{content}
+	case ruleFieldAuthor:
+		return []string{post.Author.String}
+	case ruleFieldCategory:
+		return post.Categories
+	}
+	return append([]string{post.Title, content, post.Author.String}, post.Categories...)
+}
+
+// filterRules returns the rules that apply to the new posts of a feed, for
+// every user following it.
+func (s *scraper) filterRules(ctx context.Context, feedID uuid.UUID) []filterRule {
+	dbRules, err := s.db.GetFilterRulesForFeed(ctx, uuid.NullUUID{UUID: feedID, Valid: true})
+	if err != nil {
+		log.Println("Error getting filter rules: ", fmt.Errorf("error getting filter rules: %w", err))
+		return nil
+	}
+
+	rules := make([]filterRule, 0, len(dbRules))
+	for _, dbRule := range dbRules {
+		rule, err := compileFilterRule(dbRule)
+		if err != nil {
+			log.Println("Error compiling filter rule: ", fmt.Errorf("error compiling filter rule %s: %w", dbRule.ID, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// applyFilterRules runs the action of every rule matching a new post.
+func (s *scraper) applyFilterRules(ctx context.Context, rules []filterRule, post database.Post) {
+	for _, rule := range rules {
+		if !rule.matches(post) {
+			continue
+		}
+		if err := applyFilterRuleAction(ctx, s.db, rule.FilterRule, post.ID); err != nil {
+			log.Println("Error applying filter rule: ", fmt.Errorf("error applying filter rule %s: %w", rule.ID, err))
+		}
+	}
+}
+
+func applyFilterRuleAction(ctx context.Context, db *database.Queries, rule database.FilterRule, postID uuid.UUID) error {
+	switch rule.Action {
+	case ruleActionHide:
+		_, err := db.SetPostHidden(ctx, database.SetPostHiddenParams{
+			UserID:   rule.UserID,
+			HiddenAt: sql.NullTime{Time: time.Now(), Valid: true},
+			PostID:   postID,
+		})
+		return err
+	case ruleActionMarkRead:
+		_, err := db.SetPostsRead(ctx, database.SetPostsReadParams{
+			UserID:  rule.UserID,
+			ReadAt:  readTime(true),
+			PostIds: []uuid.UUID{postID},
+		})
+		return err
+	case ruleActionStar:
+		_, err := db.StarPost(ctx, database.StarPostParams{
+			ID:     uuid.New(),
+			UserID: rule.UserID,
+			PostID: postID,
+		})
+		return err
+	case ruleActionTag:
+		tags, err := db.UpsertTags(ctx, database.UpsertTagsParams{
+			Ids:    []uuid.UUID{uuid.New()},
+			UserID: rule.UserID,
+			Names:  []string{rule.Tag.String},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = db.TagPosts(ctx, database.TagPostsParams{
+			TagIds:  []uuid.UUID{tags[0].ID},
+			PostIds: []uuid.UUID{postID},
+		})
+		return err
+	}
+	return fmt.Errorf("unknown action %q", rule.Action)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+)
+
+func TestFilterRuleMatches(t *testing.T) {
+	post := database.Post{
+		Title:       "Rust 1.80 released",
+		Description: sql.NullString{String: "<p>Lazy cells are <b>stable</b></p>", Valid: true},
+		Content:     sql.NullString{String: "<p>Sponsored by Acme</p>", Valid: true},
+		Author:      sql.NullString{String: "The Rust Team", Valid: true},
+		Categories:  []string{"Releases", "Announcements"},
+	}
+
+	regex := func(expression string) sql.NullString {
+		return sql.NullString{String: expression, Valid: true}
+	}
+
+	tests := []struct {
+		name string
+		rule database.FilterRule
+		want bool
+	}{
+		{name: "title keyword", rule: database.FilterRule{Field: ruleFieldTitle, Keywords: []string{"rust"}}, want: true},
+		{name: "keywords ignore case", rule: database.FilterRule{Field: ruleFieldTitle, Keywords: []string{"RELEASED"}}, want: true},
+		{name: "any keyword", rule: database.FilterRule{Field: ruleFieldTitle, Keywords: []string{"python", "1.80"}}, want: true},
+		{name: "keyword in another field", rule: database.FilterRule{Field: ruleFieldTitle, Keywords: []string{"acme"}}, want: false},
+		{name: "content includes description", rule: database.FilterRule{Field: ruleFieldContent, Keywords: []string{"lazy cells"}}, want: true},
+		{name: "content without markup", rule: database.FilterRule{Field: ruleFieldContent, Keywords: []string{"are stable"}}, want: true},
+		{name: "content ignores tags", rule: database.FilterRule{Field: ruleFieldContent, Keywords: []string{"<b>"}}, want: false},
+		{name: "content includes full content", rule: database.FilterRule{Field: ruleFieldContent, Keywords: []string{"sponsored"}}, want: true},
+		{name: "author", rule: database.FilterRule{Field: ruleFieldAuthor, Keywords: []string{"rust team"}}, want: true},
+		{name: "category", rule: database.FilterRule{Field: ruleFieldCategory, Keywords: []string{"releases"}}, want: true},
+		{name: "regex on category is per category", rule: database.FilterRule{Field: ruleFieldCategory, Regex: regex(`^Announcements$`)}, want: true},
+		{name: "regex doesn't span categories", rule: database.FilterRule{Field: ruleFieldCategory, Regex: regex(`Releases.*Announcements`)}, want: false},
+		{name: "any field", rule: database.FilterRule{Field: ruleFieldAny, Keywords: []string{"acme"}}, want: true},
+		{name: "any field category", rule: database.FilterRule{Field: ruleFieldAny, Regex: regex(`^Releases$`)}, want: true},
+		{name: "regex is case sensitive", rule: database.FilterRule{Field: ruleFieldTitle, Regex: regex(`rust`)}, want: false},
+		{name: "case insensitive regex", rule: database.FilterRule{Field: ruleFieldTitle, Regex: regex(`(?i)^rust \d+\.\d+`)}, want: true},
+		{name: "no match", rule: database.FilterRule{Field: ruleFieldAny, Keywords: []string{"golang"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := compileFilterRule(tt.rule)
+			if err != nil {
+				t.Fatalf("compileFilterRule() error = %v", err)
+			}
+			if got := rule.matches(post); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterRuleInvalidRegex(t *testing.T) {
+	rule := database.FilterRule{Field: ruleFieldTitle, Regex: sql.NullString{String: `(unclosed`, Valid: true}}
+	if _, err := compileFilterRule(rule); err == nil {
+		t.Error("compileFilterRule() error = nil, want an invalid regex error")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"golang.org/x/net/html"
+)
+
+// newSanitizer builds the HTML allowlist used to clean ingested post content.
+//
+//   - "ugc" keeps formatting, links, images, lists and tables (default when empty)
+//   - "basic" keeps inline formatting, paragraphs and links only
+//   - "strict" removes all markup
+//
+// Scripts, inline event handlers, styles and iframes are never allowed.
+func newSanitizer(policy string) (*bluemonday.Policy, error) {
+	var p *bluemonday.Policy
+
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", "ugc":
+		p = bluemonday.UGCPolicy()
+	case "basic":
+		p = bluemonday.NewPolicy()
+		p.AllowStandardURLs()
+		p.AllowAttrs("href").OnElements("a")
+		p.AllowElements("p", "br", "b", "strong", "i", "em", "u", "s", "blockquote", "code", "pre")
+	case "strict":
+		return bluemonday.StrictPolicy(), nil
+	default:
+		return nil, fmt.Errorf("unknown sanitizer policy %q", policy)
+	}
+
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p, nil
+}
+
+// blockElements are the tags that start a new line in the plain-text
+// rendering of a post.
+var blockElements = map[string]bool{
+	"p": true, "br": true, "div": true, "li": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "hr": true, "table": true, "ul": true, "ol": true,
+}
+
+// htmlToText renders sanitized post content as plain text, keeping paragraph
+// breaks and collapsing all other whitespace.
+func htmlToText(content string) string {
+	var lines []string
+	var current strings.Builder
+
+	flush := func() {
+		line := strings.Join(strings.Fields(current.String()), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+		current.Reset()
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				return strings.Join(strings.Fields(content), " ")
+			}
+			break
+		}
+
+		switch tokenType {
+		case html.TextToken:
+			current.Write(tokenizer.Text())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			if blockElements[string(name)] {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	return strings.Join(lines, "\n")
+}
@@ -3,25 +3,49 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/darthvadr/rss-aggregator/internal/database"
 	"github.com/google/uuid"
+	"github.com/microcosm-cc/bluemonday"
 )
 
+// ScrapeResult reports what a single fetch of a feed did.
+type ScrapeResult struct {
+	FeedID    uuid.UUID `json:"feed_id"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Items     int       `json:"items"`
+	NewPosts  int       `json:"new_posts"`
+	Error     string    `json:"error,omitempty"`
+}
 
+// scraper holds everything the ingestion pipeline needs to turn feed items
+// into posts.
+type scraper struct {
+	db            *database.Queries
+	sanitizer     *bluemonday.Policy
+	canonicalizer *urlCanonicalizer
+	fetcher       *fetcher
+	// posts is told about every post stored
+	posts postPublisher
+	// webhooks queues the deliveries of every post stored
+	webhooks *webhookDispatcher
+}
 
-func startScraping(db *database.Queries, concurrency int, interval time.Duration) {
+func (s *scraper) start(concurrency int, interval time.Duration) {
 
 	log.Println("Starting scraper with concurrency:", concurrency, "and interval:", interval)
-	
+
 	ticker := time.NewTicker(interval)
 
 	for ; ; <-ticker.C {
 
-		feeds, err := db.GetNextFeedsToFetch(context.Background(), int32(concurrency))
+		feeds, err := s.db.GetNextFeedsToFetch(context.Background(), int32(concurrency))
 		if err != nil {
 			log.Println("Error fetching feeds:", err)
 			continue
@@ -32,7 +56,7 @@ func startScraping(db *database.Queries, concurrency int, interval time.Duration
 		for _, feed := range feeds {
 			wg.Add(1)
 
-			go scrapeFeed(db, feed, &wg)
+			go s.scrapeFeed(feed, &wg)
 		}
 
 		wg.Wait()
@@ -40,36 +64,51 @@ func startScraping(db *database.Queries, concurrency int, interval time.Duration
 }
 
 
-func scrapeFeed( db *database.Queries, feed database.Feed, wg *sync.WaitGroup) {
+func (s *scraper) scrapeFeed(feed database.Feed, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	s.refreshFeed(context.Background(), feed)
+}
+
+// refreshFeed fetches a feed and stores its new items as posts. It is used by
+// the scraper loop and to refresh a single feed on demand.
+func (s *scraper) refreshFeed(ctx context.Context, feed database.Feed) ScrapeResult {
+	result := ScrapeResult{FeedID: feed.ID, FetchedAt: time.Now()}
+
 	log.Println("Scraping feed:", feed.ID, feed.Url)
 
 	// Update last_fetched_at immediately to avoid multiple workers fetching the same feed
 	// and allow last_fetched_at to be updated once in this function
-	err := db.UpdateFeedLastFetchedAt(context.Background(), feed.ID)
+	err := s.db.UpdateFeedLastFetchedAt(ctx, feed.ID)
 	if err != nil {
 		log.Println("Error updating feed last fetched at:", err)
-		return
+		result.Error = err.Error()
+		return result
 	}
 
 	if feed.Url == "" {
 		log.Println("Feed URL is empty, skipping")
-		return
+		result.Error = "feed URL is empty"
+		return result
 	}
 
-	rssFeed, err := urlToFeed(feed.Url)
+	rssFeed, err := urlToFeed(ctx, s.fetcher, feed.Url)
 	if err != nil {
 		log.Println("Error fetching RSS feed:", err)
-		return
+		result.Error = err.Error()
+		return result
 	}
 
+	result.Items = len(rssFeed.Channel.Items)
 	log.Printf("Fetched %d items from feed %s\n", len(rssFeed.Channel.Items), feed.Url)
 
+	// The rules of the users following the feed, run against each new post
+	rules := s.filterRules(ctx, feed.ID)
+
 	for _, item := range rssFeed.Channel.Items {
 
 		log.Printf("Item: %s - %s\n", item.Title, item.Link)
-	
+
 
 		parsedTime, err := time.Parse(time.RFC1123Z, item.PubDate)
 		if err != nil {
@@ -77,24 +116,113 @@ func scrapeFeed( db *database.Queries, feed database.Feed, wg *sync.WaitGroup) {
 			continue
 		}
 
+		// Items already stored for this feed are skipped before any work is
+		// spent on them, the insert below still ignores those stored meanwhile
+		exists, err := s.db.PostExists(ctx, database.PostExistsParams{
+			FeedID: uuid.NullUUID{UUID: feed.ID, Valid: true},
+			Url:    item.Link,
+		})
+		if err != nil {
+			log.Printf("Error checking post '%s': %v", item.Link, err)
+		}
+		if exists {
+			continue
+		}
+
+		// Never store feed-provided markup as is, it ends up rendered by our clients
+		description := s.sanitizer.Sanitize(item.Description)
+
+		// The original link is kept as is, the canonical one is used to spot duplicates
+		canonicalURL := s.canonicalizer.canonicalize(item.Link)
+
+		// Feeds that only ship a summary can opt in to fetching the whole article
+		content := ""
+		if feed.FetchFullContent {
+			content, canonicalURL = s.fetchFullContent(ctx, item.Link, canonicalURL)
+		}
+
+		attachments := []byte("[]")
+		if len(item.Enclosures) > 0 {
+			if attachments, err = json.Marshal(item.Enclosures); err != nil {
+				log.Printf("Error encoding enclosures: %v", err)
+				attachments = []byte("[]")
+			}
+		}
+
+		author := strings.TrimSpace(item.Creator)
+		if author == "" {
+			author = strings.TrimSpace(item.Author)
+		}
+		categories := []string{}
+		for _, category := range item.Categories {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+
+		// Group the post with the same story published by other feeds
+		postID := uuid.New()
+		fingerprint, ok := simhash(item.Title + " " + htmlToText(description+" "+content))
+		clusterID, err := findStoryCluster(ctx, s.db, postID, canonicalURL,
+			sql.NullInt64{Int64: fingerprint, Valid: ok}, parsedTime)
+		if err != nil {
+			log.Printf("Error finding story cluster: %v", err)
+			clusterID = postID
+		}
+
 		// Here you would typically save the item to the database
-		_, err = db.CreatePost(context.Background(), 
+		createdPost, err := s.db.CreatePost(ctx,
 			database.CreatePostParams{
-				ID: uuid.New(),
+				ID: postID,
 				Title: item.Title,
-				Description: sql.NullString{String: item.Description, Valid: item.Description != ""},
+				Description: sql.NullString{String: description, Valid: description != ""},
 				Url: item.Link,
-				Userid: feed.UserID,
+				CanonicalUrl: sql.NullString{String: canonicalURL, Valid: canonicalURL != ""},
 				PublishedAt: parsedTime,
 				CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
 				UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
 				FeedID: uuid.NullUUID{UUID: feed.ID, Valid: true},
+				Fingerprint: sql.NullInt64{Int64: fingerprint, Valid: ok},
+				ClusterID: uuid.NullUUID{UUID: clusterID, Valid: true},
+				Content: sql.NullString{String: content, Valid: content != ""},
+				Attachments: attachments,
+				Author: sql.NullString{String: author, Valid: author != ""},
+				Categories: categories,
 			})
+		// Items already stored for this feed are skipped by the insert
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
 		if err != nil {
 			log.Printf("Error creating post: %v", err)
+			continue
 		}
+
+		result.NewPosts++
+		s.applyFilterRules(ctx, rules, createdPost)
+		s.posts.publishPost(ctx, createdPost)
+		s.webhooks.enqueuePost(ctx, createdPost)
 	}
 
 
 	log.Printf("Finished scraping feed %d - %s\n", feed.ID, feed.Url)
+
+	return result
+}
+
+// fetchFullContent downloads the article behind link and returns its sanitized
+// main content, along with the canonical URL to use for the post.
+func (s *scraper) fetchFullContent(ctx context.Context, link string, canonicalURL string) (string, string) {
+	article, err := fetchArticle(ctx, s.fetcher, link)
+	if err != nil {
+		log.Printf("Error fetching article '%s': %v", link, err)
+		return "", canonicalURL
+	}
+
+	// rel=canonical is the publisher's own answer to which URL is the real one
+	if article.CanonicalURL != "" {
+		canonicalURL = s.canonicalizer.canonicalize(article.CanonicalURL)
+	}
+
+	return s.sanitizer.Sanitize(article.Content), canonicalURL
 }
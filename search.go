@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var errEmptySearch = errors.New("search query has no words to look for")
+
+// searchTerm is a word, a prefix or a quoted phrase of the search box.
+type searchTerm struct {
+	words   []string
+	prefix  bool
+	negated bool
+	or      bool // joined to the previous term with OR instead of AND
+}
+
+// parseSearchQuery turns what a user typed in a search box into a to_tsquery
+// expression. It understands a small web search syntax:
+//
+//   - words are all required: rust async
+//   - "quoted words" must appear next to each other, in order
+//   - word* matches any word starting with word
+//   - -word excludes posts containing word
+//   - OR between two terms accepts either of them
+//
+// Anything else is treated as a separator, so the result never contains
+// operators the user didn't ask for and to_tsquery can't fail on it.
+func parseSearchQuery(input string) (string, error) {
+	var terms []searchTerm
+	or := false
+
+	for input = strings.TrimSpace(input); input != ""; input = strings.TrimSpace(input) {
+		term := searchTerm{or: or}
+		or = false
+
+		if input[0] == '-' {
+			term.negated = true
+			input = input[1:]
+		}
+
+		var raw string
+		if strings.HasPrefix(input, `"`) {
+			end := strings.Index(input[1:], `"`)
+			if end < 0 {
+				raw, input = input[1:], ""
+			} else {
+				raw, input = input[1:end+1], input[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(input, unicode.IsSpace)
+			if end < 0 {
+				end = len(input)
+			}
+			raw, input = input[:end], input[end:]
+
+			if raw == "OR" && !term.negated {
+				or = len(terms) > 0
+				continue
+			}
+		}
+
+		raw = strings.TrimSpace(raw)
+		if strings.HasSuffix(raw, "*") {
+			term.prefix = true
+			raw = strings.TrimRight(raw, "*")
+		}
+
+		term.words = strings.FieldsFunc(strings.ToLower(raw), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(term.words) == 0 {
+			continue
+		}
+		terms = append(terms, term)
+	}
+
+	// Terms joined with OR form a group, groups are all required. A group
+	// made only of exclusions would match nearly every post, so at least one
+	// term has to be something to look for.
+	var groups []string
+	var group []string
+	positive := false
+	for i, term := range terms {
+		if i > 0 && !term.or {
+			groups = append(groups, joinSearchGroup(group))
+			group = nil
+		}
+		group = append(group, term.String())
+		positive = positive || !term.negated
+	}
+	if len(group) > 0 {
+		groups = append(groups, joinSearchGroup(group))
+	}
+
+	if !positive {
+		return "", errEmptySearch
+	}
+	return strings.Join(groups, " & "), nil
+}
+
+func joinSearchGroup(group []string) string {
+	if len(group) == 1 {
+		return group[0]
+	}
+	return "(" + strings.Join(group, " | ") + ")"
+}
+
+func (t searchTerm) String() string {
+	words := make([]string, len(t.words))
+	copy(words, t.words)
+	if t.prefix {
+		words[len(words)-1] += ":*"
+	}
+
+	expression := strings.Join(words, " <-> ")
+	if len(words) > 1 {
+		expression = "(" + expression + ")"
+	}
+	if t.negated {
+		expression = "!" + expression
+	}
+	return expression
+}
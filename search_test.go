@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "words are all required", input: "rust async", want: "rust & async"},
+		{name: "words are lowercased", input: "Rust ASYNC", want: "rust & async"},
+		{name: "phrase", input: `"rust async" book`, want: "(rust <-> async) & book"},
+		{name: "unterminated phrase", input: `"rust async`, want: "(rust <-> async)"},
+		{name: "prefix", input: "rust*", want: "rust:*"},
+		{name: "prefix phrase", input: `"async run*"`, want: "(async <-> run:*)"},
+		{name: "negation", input: "rust -python", want: "rust & !python"},
+		{name: "negated phrase", input: `rust -"web framework"`, want: "rust & !(web <-> framework)"},
+		{name: "or", input: "rust OR go", want: "(rust | go)"},
+		{name: "or binds tighter than and", input: "web rust OR go", want: "web & (rust | go)"},
+		{name: "or chain", input: "rust OR go OR zig", want: "(rust | go | zig)"},
+		{name: "leading or is a separator", input: "OR rust", want: "rust"},
+		{name: "trailing or is a separator", input: "rust OR", want: "rust"},
+		{name: "double or", input: "rust OR OR go", want: "(rust | go)"},
+		{name: "lowercase or is a word", input: "rust or go", want: "rust & or & go"},
+		{name: "negated or is an exclusion", input: "rust -OR", want: "rust & !or"},
+		{name: "or with exclusion", input: "rust OR -go", want: "(rust | !go)"},
+		{name: "operators are separators", input: "c++ & !rust", want: "c & rust"},
+		{name: "punctuated word is a phrase", input: "e-mail (rust|go)", want: "(e <-> mail) & (rust <-> go)"},
+		{name: "negation only", input: "-python", wantErr: errEmptySearch},
+		{name: "several negations only", input: `-python -"web framework"`, wantErr: errEmptySearch},
+		{name: "empty", input: "   ", wantErr: errEmptySearch},
+		{name: "punctuation only", input: `!!! "" *`, wantErr: errEmptySearch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSearchQuery(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseSearchQuery(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSearchQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+-- name: CreateCollection :one
+INSERT INTO collections (id, user_id, slug, name, description)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetCollectionBySlug :one
+SELECT * FROM collections WHERE slug = $1;
+
+-- name: GetCollectionsForUser :many
+SELECT * FROM collections
+WHERE user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetCollectionsForUserAfter :many
+SELECT * FROM collections
+WHERE user_id = sqlc.arg(user_id)
+  AND (created_at, id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: UpdateCollection :one
+UPDATE collections
+SET name = $2, description = $3, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteCollection :execrows
+DELETE FROM collections WHERE id = $1 AND user_id = $2;
+
+-- name: GetCollectionFeeds :many
+SELECT f.* FROM feeds f
+JOIN collection_feeds cf ON cf.feed_id = f.id
+WHERE cf.collection_id = $1
+ORDER BY lower(f.title), f.id;
+
+-- name: GetFeedsForCollections :many
+SELECT cf.collection_id, sqlc.embed(f) FROM feeds f
+JOIN collection_feeds cf ON cf.feed_id = f.id
+WHERE cf.collection_id = ANY(sqlc.arg(collection_ids)::uuid[])
+ORDER BY lower(f.title), f.id;
+
+-- name: AddCollectionFeeds :many
+-- Only feeds the collection's owner follows are added.
+INSERT INTO collection_feeds (collection_id, feed_id)
+SELECT c.id, f.id FROM collections c
+JOIN feed_follows ff ON ff.user_id = c.user_id
+JOIN feeds f ON f.id = ff.feed_id
+WHERE c.id = sqlc.arg(collection_id)::uuid AND f.id = ANY(sqlc.arg(feed_ids)::uuid[])
+ON CONFLICT (collection_id, feed_id) DO NOTHING
+RETURNING feed_id;
+
+-- name: RemoveCollectionFeeds :execrows
+DELETE FROM collection_feeds
+WHERE collection_id = sqlc.arg(collection_id) AND feed_id = ANY(sqlc.arg(feed_ids)::uuid[]);
+
+-- name: UpsertCollectionSubscription :one
+INSERT INTO collection_subscriptions (collection_id, user_id, track_additions)
+VALUES ($1, $2, $3)
+ON CONFLICT (collection_id, user_id) DO UPDATE
+SET track_additions = EXCLUDED.track_additions, updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeleteCollectionSubscription :execrows
+DELETE FROM collection_subscriptions WHERE collection_id = $1 AND user_id = $2;
+
+-- name: FollowCollectionFeeds :execrows
+INSERT INTO feed_follows (id, user_id, feed_id)
+SELECT gen_random_uuid(), sqlc.arg(user_id)::uuid, cf.feed_id
+FROM collection_feeds cf
+WHERE cf.collection_id = sqlc.arg(collection_id)
+ON CONFLICT (user_id, feed_id) DO NOTHING;
+
+-- name: FollowFeedsForTrackingSubscribers :execrows
+-- Follows feeds added to a collection on behalf of the subscribers tracking
+-- its additions.
+INSERT INTO feed_follows (id, user_id, feed_id)
+SELECT gen_random_uuid(), cs.user_id, f.feed_id
+FROM collection_subscriptions cs, unnest(sqlc.arg(feed_ids)::uuid[]) AS f(feed_id)
+WHERE cs.collection_id = sqlc.arg(collection_id) AND cs.track_additions
+ON CONFLICT (user_id, feed_id) DO NOTHING;
+
+-- name: GetPostsForCollection :many
+SELECT p.* FROM posts p
+WHERE p.feed_id IN (SELECT cf.feed_id FROM collection_feeds cf WHERE cf.collection_id = $1)
+ORDER BY p.published_at DESC, p.id DESC
+LIMIT $2;
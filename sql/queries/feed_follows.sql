@@ -1,10 +1,58 @@
 -- name: CreateFeedFollows :one
-INSERT INTO feed_follows (id, user_id, feed_id)
-VALUES ($1, $2, $3)
+INSERT INTO feed_follows (id, user_id, feed_id, title)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: UpsertFeedFollows :one
+INSERT INTO feed_follows (id, user_id, feed_id, title)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, feed_id) DO UPDATE SET title = COALESCE(EXCLUDED.title, feed_follows.title)
 RETURNING *;
 
 -- name: GetFeedFollows :many
-SELECT * FROM feed_follows WHERE user_id = $1;
+SELECT * FROM feed_follows
+WHERE user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetFeedFollowsAfter :many
+SELECT * FROM feed_follows
+WHERE user_id = sqlc.arg(user_id)
+  AND (created_at, id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: IsFollowingFeed :one
+SELECT EXISTS(SELECT 1 FROM feed_follows WHERE user_id = $1 AND feed_id = $2);
+
+-- name: UpdateFeedFollowTitle :one
+UPDATE feed_follows
+SET title = $3, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteFeedFollows :execrows
+DELETE FROM feed_follows WHERE user_id = $1 AND id = $2;
+
+-- name: DeleteFeedFollowsByFeed :execrows
+DELETE FROM feed_follows WHERE user_id = $1 AND feed_id = $2;
+
+-- name: DeleteFeedFollowsBulk :many
+DELETE FROM feed_follows WHERE user_id = sqlc.arg(user_id) AND id = ANY(sqlc.arg(ids)::uuid[])
+RETURNING id;
+-- name: GetFeedFollowsWithFeeds :many
+SELECT ff.*, f.title AS feed_title, f.url AS feed_url
+FROM feed_follows ff
+JOIN feeds f ON f.id = ff.feed_id
+WHERE ff.user_id = $1
+ORDER BY lower(COALESCE(ff.title, f.title)), ff.id;
+
+-- name: GetFollowedFeedIDs :many
+SELECT feed_id FROM feed_follows WHERE user_id = $1 AND feed_id IS NOT NULL;
 
--- name: DeleteFeedFollows :exec
-DELETE FROM feed_follows WHERE user_id = $1 AND feed_id = $2;
\ No newline at end of file
+-- name: GetFeedFollow :one
+SELECT * FROM feed_follows WHERE id = $1 AND user_id = $2;
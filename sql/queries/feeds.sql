@@ -1,13 +1,50 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, title, url, user_id) 
-VALUES ($1, $2, $3, $4) 
+INSERT INTO feeds (id, title, url, user_id, fetch_full_content) 
+VALUES ($1, $2, $3, $4, $5) 
+ON CONFLICT (url) DO NOTHING
 RETURNING *;
 
+-- name: GetFeedByURL :one
+SELECT * FROM feeds WHERE url = $1;
+
 -- name: GetFeeds :many
-SELECT * FROM feeds ORDER BY created_at DESC;
+SELECT * FROM feeds
+WHERE sqlc.narg(before_time)::timestamptz IS NULL
+   OR (created_at, id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetFeedsAfter :many
+SELECT * FROM feeds
+WHERE (created_at, id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetFeed :one
+SELECT * FROM feeds WHERE id = $1;
+
+-- name: UpdateFeed :one
+UPDATE feeds
+SET title = $2, url = $3, fetch_full_content = $4, enabled = $5, poll_interval_minutes = $6, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteFeed :execrows
+DELETE FROM feeds WHERE id = $1 AND user_id = $2;
 
 -- name: GetNextFeedsToFetch :many
+-- Feeds nobody follows or collects are left alone until someone does.
 SELECT * FROM feeds 
+WHERE enabled
+  AND (
+    EXISTS(SELECT 1 FROM feed_follows ff WHERE ff.feed_id = feeds.id)
+    OR EXISTS(SELECT 1 FROM collection_feeds cf WHERE cf.feed_id = feeds.id)
+  )
+  AND (
+    last_fetched_at IS NULL
+    OR poll_interval_minutes IS NULL
+    OR last_fetched_at < NOW() - make_interval(mins => poll_interval_minutes)
+  )
 ORDER BY last_fetched_at ASC NULLS FIRST 
 LIMIT $1;
 
@@ -15,4 +52,23 @@ LIMIT $1;
 UPDATE feeds 
 SET last_fetched_at = NOW(), updated_at = CURRENT_TIMESTAMP 
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: ClaimFeedRefresh :execrows
+-- Marks the feed fetched unless it was fetched after fetched_before, in
+-- which case no row is updated.
+UPDATE feeds
+SET last_fetched_at = NOW(), updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id)
+  AND (last_fetched_at IS NULL OR last_fetched_at < sqlc.arg(fetched_before)::timestamptz);
+
+-- name: FeedHasOtherUsers :one
+-- Whether anyone but user_id follows the feed or has it in a collection.
+SELECT EXISTS(
+    SELECT 1 FROM feed_follows ff
+    WHERE ff.feed_id = sqlc.arg(feed_id)::uuid AND ff.user_id IS DISTINCT FROM sqlc.arg(user_id)::uuid
+    UNION ALL
+    SELECT 1 FROM collection_feeds cf
+    JOIN collections c ON c.id = cf.collection_id
+    WHERE cf.feed_id = sqlc.arg(feed_id)::uuid AND c.user_id <> sqlc.arg(user_id)::uuid
+);
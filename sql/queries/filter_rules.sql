@@ -0,0 +1,41 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, user_id, feed_follow_id, name, field, keywords, regex, action, tag)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetFilterRules :many
+SELECT * FROM filter_rules
+WHERE user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetFilterRulesAfter :many
+SELECT * FROM filter_rules
+WHERE user_id = sqlc.arg(user_id)
+  AND (created_at, id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE id = $1 AND user_id = $2;
+
+-- name: GetFilterRulesForFeed :many
+-- The rules of every user following the feed that apply to it.
+SELECT r.* FROM filter_rules r
+JOIN feed_follows ff ON ff.user_id = r.user_id
+WHERE ff.feed_id = $1
+  AND (r.feed_follow_id IS NULL OR r.feed_follow_id = ff.id)
+ORDER BY r.user_id, r.created_at, r.id;
+
+-- name: GetRecentFollowedPosts :many
+-- The latest posts stored for the feeds a user follows, or for one follow.
+SELECT p.* FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(feed_follow_id)::uuid IS NULL OR ff.id = sqlc.narg(feed_follow_id)::uuid)
+ORDER BY p.created_at DESC, p.id DESC
+LIMIT sqlc.arg(row_limit);
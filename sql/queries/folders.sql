@@ -0,0 +1,52 @@
+-- name: CreateFolder :one
+INSERT INTO folders (id, user_id, parent_id, name)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetFolder :one
+SELECT * FROM folders WHERE id = $1 AND user_id = $2;
+
+-- name: GetFolders :many
+SELECT * FROM folders WHERE user_id = $1 ORDER BY lower(name), id;
+
+-- name: FolderHasChildren :one
+SELECT EXISTS(SELECT 1 FROM folders WHERE parent_id = $1);
+
+-- name: UpdateFolder :one
+UPDATE folders
+SET name = $3, parent_id = $4, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteFolder :execrows
+DELETE FROM folders WHERE id = $1 AND user_id = $2;
+
+-- name: MoveFeedFollowsToFolder :many
+UPDATE feed_follows
+SET folder_id = sqlc.narg(folder_id), updated_at = CURRENT_TIMESTAMP
+WHERE user_id = sqlc.arg(user_id) AND id = ANY(sqlc.arg(ids)::uuid[])
+RETURNING id;
+
+-- name: RemoveFeedFollowsFromFolder :many
+UPDATE feed_follows
+SET folder_id = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE user_id = sqlc.arg(user_id) AND folder_id = sqlc.arg(folder_id) AND id = ANY(sqlc.arg(ids)::uuid[])
+RETURNING id;
+
+-- name: GetFolderTreeFeeds :many
+-- Every feed a user follows, with the number of posts they haven't read or
+-- hidden.
+SELECT ff.id, ff.feed_id, ff.folder_id, COALESCE(ff.title, f.title)::text AS title,
+    (
+        SELECT count(*) FROM posts p
+        LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+        WHERE p.feed_id = ff.feed_id AND ps.read_at IS NULL AND ps.hidden_at IS NULL
+    ) AS unread_count
+FROM feed_follows ff
+JOIN feeds f ON f.id = ff.feed_id
+WHERE ff.user_id = $1
+ORDER BY lower(COALESCE(ff.title, f.title)), ff.id;
+
+-- name: GetFolderByName :one
+SELECT * FROM folders
+WHERE user_id = sqlc.arg(user_id) AND parent_id IS NOT DISTINCT FROM sqlc.narg(parent_id) AND name = sqlc.arg(name);
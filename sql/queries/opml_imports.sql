@@ -0,0 +1,31 @@
+-- name: CreateOPMLImport :one
+INSERT INTO opml_imports (id, user_id, status)
+VALUES ($1, $2, 'running')
+RETURNING *;
+
+-- name: CreateOPMLImportItem :one
+INSERT INTO opml_import_items (id, import_id, position, url, title, folder, subfolder)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: UpdateOPMLImportItem :exec
+UPDATE opml_import_items
+SET status = $2, feed_id = $3, error = $4
+WHERE id = $1;
+
+-- name: FinishOPMLImport :exec
+UPDATE opml_imports
+SET status = $2, error = $3, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: FailInterruptedOPMLImports :execrows
+-- Imports still running when the server starts were cut short by a restart.
+UPDATE opml_imports
+SET status = 'failed', error = 'interrupted by a server restart', finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE status = 'running';
+
+-- name: GetOPMLImport :one
+SELECT * FROM opml_imports WHERE id = $1 AND user_id = $2;
+
+-- name: GetOPMLImportItems :many
+SELECT * FROM opml_import_items WHERE import_id = $1 ORDER BY position;
@@ -0,0 +1,49 @@
+-- name: SetPostsRead :many
+-- Marks posts of followed feeds read, or unread when read_at is NULL. A post
+-- keeps the time it was first read.
+INSERT INTO post_states (user_id, post_id, read_at)
+SELECT sqlc.arg(user_id)::uuid, p.id, sqlc.narg(read_at)::timestamptz
+FROM posts p
+WHERE p.id = ANY(sqlc.arg(post_ids)::uuid[])
+  AND p.feed_id IN (SELECT ff.feed_id FROM feed_follows ff WHERE ff.user_id = sqlc.arg(user_id)::uuid)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read_at = CASE WHEN EXCLUDED.read_at IS NULL THEN NULL ELSE COALESCE(post_states.read_at, EXCLUDED.read_at) END,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING post_id;
+
+-- name: MarkFeedReadBefore :execrows
+INSERT INTO post_states (user_id, post_id, read_at)
+SELECT sqlc.arg(user_id)::uuid, p.id, sqlc.arg(read_at)::timestamptz
+FROM posts p
+WHERE p.feed_id = sqlc.arg(feed_id)::uuid
+  AND p.published_at < sqlc.arg(published_before)::timestamptz
+  AND NOT EXISTS (
+    SELECT 1 FROM post_states ps
+    WHERE ps.user_id = sqlc.arg(user_id)::uuid AND ps.post_id = p.id AND ps.read_at IS NOT NULL
+  )
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read_at = EXCLUDED.read_at, updated_at = CURRENT_TIMESTAMP;
+
+-- name: CountUnreadPostsByFeed :many
+SELECT p.feed_id, count(*) AS unread_count
+FROM posts p
+LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = sqlc.arg(user_id)::uuid
+WHERE p.feed_id = ANY(sqlc.arg(feed_ids)::uuid[])
+  AND ps.read_at IS NULL
+  AND ps.hidden_at IS NULL
+GROUP BY p.feed_id;
+
+-- name: SetPostHidden :execrows
+-- Hides a post of a followed feed, or shows it again when hidden_at is NULL.
+INSERT INTO post_states (user_id, post_id, hidden_at)
+SELECT sqlc.arg(user_id)::uuid, p.id, sqlc.narg(hidden_at)::timestamptz
+FROM posts p
+WHERE p.id = sqlc.arg(post_id)::uuid
+  AND p.feed_id IN (SELECT ff.feed_id FROM feed_follows ff WHERE ff.user_id = sqlc.arg(user_id)::uuid)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET hidden_at = EXCLUDED.hidden_at, updated_at = CURRENT_TIMESTAMP;
+
+-- name: IsPostHidden :one
+SELECT EXISTS(
+    SELECT 1 FROM post_states WHERE user_id = $1 AND post_id = $2 AND hidden_at IS NOT NULL
+);
@@ -1,6 +1,78 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, url, userId, title, description, published_at, created_at, updated_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+INSERT INTO posts (id, url, title, description, published_at, created_at, updated_at, feed_id, canonical_url, fingerprint, cluster_id, content, attachments, author, categories)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+ON CONFLICT (feed_id, url) DO NOTHING
+RETURNING *;
+
+-- name: PostExists :one
+SELECT EXISTS(SELECT 1 FROM posts WHERE feed_id = $1 AND url = $2);
 
 -- name: GetPostsForUser :many
-SELECT p.* FROM posts p JOIN feed_follows ff ON p.feed_id = ff.feed_id WHERE ff.user_id = $1 ORDER BY p.published_at DESC LIMIT $2;
\ No newline at end of file
+SELECT p.* FROM posts p JOIN feed_follows ff ON p.feed_id = ff.feed_id
+WHERE ff.user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (p.published_at, p.id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY p.published_at DESC, p.id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: FindPostCluster :one
+SELECT cluster_id FROM posts
+WHERE cluster_id IS NOT NULL
+  AND (
+    canonical_url = sqlc.arg(canonical_url)
+    OR (
+      published_at > sqlc.arg(published_after)
+      AND fingerprint IS NOT NULL
+      AND sqlc.narg(fingerprint)::bigint IS NOT NULL
+      AND bit_count((fingerprint # sqlc.narg(fingerprint)::bigint)::bit(64)) <= sqlc.arg(max_distance)::int
+    )
+  )
+ORDER BY published_at ASC
+LIMIT 1;
+
+-- name: GetClusterSourcesForUser :many
+SELECT DISTINCT ON (p.cluster_id, p.feed_id) p.cluster_id, p.id, p.feed_id, p.url, COALESCE(ff.title, f.title)::text AS feed_title
+FROM posts p
+JOIN feed_follows ff ON p.feed_id = ff.feed_id
+JOIN feeds f ON f.id = p.feed_id
+WHERE ff.user_id = sqlc.arg(user_id) AND p.cluster_id = ANY(sqlc.arg(cluster_ids)::uuid[])
+ORDER BY p.cluster_id, p.feed_id, p.published_at ASC;
+
+-- name: SearchPostsForUser :many
+SELECT p.id, p.url, p.title, p.published_at, p.feed_id,
+    ts_rank_cd(p.search_vector, q.query)::real AS rank,
+    ts_headline(
+        'english',
+        regexp_replace(coalesce(NULLIF(p.content, ''), NULLIF(p.description, ''), p.title), '<[^>]*>', ' ', 'g'),
+        q.query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10'
+    )::text AS snippet
+FROM posts p, (SELECT to_tsquery('english', sqlc.arg(query)::text) AS query) q
+WHERE p.feed_id IN (SELECT ff.feed_id FROM feed_follows ff WHERE ff.user_id = sqlc.arg(user_id))
+  AND p.search_vector @@ q.query
+  AND (sqlc.narg(since)::timestamptz IS NULL OR p.published_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamptz IS NULL OR p.published_at < sqlc.narg(until))
+ORDER BY rank DESC, p.published_at DESC, p.id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: GetPostByID :one
+SELECT * FROM posts WHERE id = $1;
+
+-- name: GetPostsForUserAfterSeq :many
+-- Posts stored after the one numbered after_seq, oldest first, to replay a
+-- stream of new posts.
+SELECT p.* FROM posts p
+JOIN feed_follows ff ON p.feed_id = ff.feed_id
+WHERE ff.user_id = sqlc.arg(user_id)
+  AND p.seq > sqlc.arg(after_seq)::bigint
+  AND NOT EXISTS (
+    SELECT 1 FROM post_states ps
+    WHERE ps.user_id = sqlc.arg(user_id)::uuid AND ps.post_id = p.id AND ps.hidden_at IS NOT NULL
+  )
+ORDER BY p.seq
+LIMIT sqlc.arg(row_limit);
+
+-- name: NotifyNewPost :exec
+SELECT pg_notify('new_posts', sqlc.arg(post_id)::text);
@@ -0,0 +1,34 @@
+-- name: StarPost :one
+-- Saves a copy of a post of a followed feed. Starring a post twice returns the
+-- copy saved the first time.
+INSERT INTO starred_posts (id, user_id, post_id, feed_id, feed_title, url, title, description, content, attachments, published_at)
+SELECT sqlc.arg(id)::uuid, ff.user_id, p.id, p.feed_id, COALESCE(ff.title, f.title), p.url, p.title, p.description, p.content, p.attachments, p.published_at
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg(user_id)::uuid
+WHERE p.id = sqlc.arg(post_id)::uuid
+ON CONFLICT (user_id, post_id) DO UPDATE SET updated_at = starred_posts.updated_at
+RETURNING *;
+
+-- name: UnstarPost :execrows
+DELETE FROM starred_posts WHERE user_id = $1 AND post_id = $2;
+
+-- name: DeleteStarredPost :execrows
+DELETE FROM starred_posts WHERE user_id = $1 AND id = $2;
+
+-- name: GetStarredPosts :many
+SELECT * FROM starred_posts
+WHERE user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetStarredPostsAfter :many
+SELECT * FROM starred_posts
+WHERE user_id = sqlc.arg(user_id)
+  AND (created_at, id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
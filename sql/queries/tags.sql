@@ -0,0 +1,52 @@
+-- name: UpsertTags :many
+-- Returns the user's tags with the given names, creating the missing ones.
+-- ids holds a new ID for each name.
+INSERT INTO tags (id, user_id, name)
+SELECT unnest(sqlc.arg(ids)::uuid[]), sqlc.arg(user_id)::uuid, unnest(sqlc.arg(names)::text[])
+ON CONFLICT (user_id, name) DO UPDATE SET updated_at = tags.updated_at
+RETURNING *;
+
+-- name: GetFollowedPostIDs :many
+-- Keeps the posts of feeds the user follows among the given IDs.
+SELECT p.id FROM posts p
+WHERE p.id = ANY(sqlc.arg(post_ids)::uuid[])
+  AND p.feed_id IN (SELECT ff.feed_id FROM feed_follows ff WHERE ff.user_id = sqlc.arg(user_id)::uuid);
+
+-- name: TagPosts :execrows
+INSERT INTO post_tags (tag_id, post_id)
+SELECT t, p FROM unnest(sqlc.arg(tag_ids)::uuid[]) t, unnest(sqlc.arg(post_ids)::uuid[]) p
+ON CONFLICT (tag_id, post_id) DO NOTHING;
+
+-- name: UntagPosts :execrows
+DELETE FROM post_tags pt
+USING tags t
+WHERE pt.tag_id = t.id
+  AND t.user_id = sqlc.arg(user_id)::uuid
+  AND t.name = ANY(sqlc.arg(names)::text[])
+  AND pt.post_id = ANY(sqlc.arg(post_ids)::uuid[]);
+
+-- name: GetTagsWithCounts :many
+SELECT t.id, t.name, t.created_at, count(pt.post_id) AS post_count
+FROM tags t
+LEFT JOIN post_tags pt ON pt.tag_id = t.id
+WHERE t.user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (t.created_at, t.id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+GROUP BY t.id
+ORDER BY t.created_at DESC, t.id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetTagsWithCountsAfter :many
+SELECT t.id, t.name, t.created_at, count(pt.post_id) AS post_count
+FROM tags t
+LEFT JOIN post_tags pt ON pt.tag_id = t.id
+WHERE t.user_id = sqlc.arg(user_id)
+  AND (t.created_at, t.id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+GROUP BY t.id
+ORDER BY t.created_at ASC, t.id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: DeleteTag :execrows
+DELETE FROM tags WHERE id = $1 AND user_id = $2;
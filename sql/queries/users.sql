@@ -1,7 +1,16 @@
 -- name: CreateUser :one
-INSERT INTO users (id, name, api_key) 
-VALUES ($1, $2,  encode(sha256(random()::text::bytea), 'hex')) 
+INSERT INTO users (id, name, api_key, feed_token) 
+VALUES ($1, $2,  encode(sha256(random()::text::bytea), 'hex'), $3) 
 RETURNING *;
 
 -- name: GetUserByApiKey :one
-SELECT * FROM users WHERE api_key = $1;
\ No newline at end of file
+SELECT * FROM users WHERE api_key = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: RotateFeedToken :one
+UPDATE users
+SET feed_token = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,105 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, user_id, url, secret, feed_id, keywords)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebhooks :many
+SELECT * FROM webhooks
+WHERE user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetWebhooksAfter :many
+SELECT * FROM webhooks
+WHERE user_id = sqlc.arg(user_id)
+  AND (created_at, id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebhookDeliveriesForPost :many
+-- Queues a delivery of the post for every webhook it matches: the webhook's
+-- user follows its feed and hasn't hidden it, and the feed and keywords
+-- filters let it through.
+INSERT INTO webhook_deliveries (id, webhook_id, post_id, event, payload)
+SELECT gen_random_uuid(), w.id, p.id, 'post.created', jsonb_set(sqlc.arg(payload)::jsonb, '{webhook_id}', to_jsonb(w.id))
+FROM webhooks w
+JOIN posts p ON p.id = sqlc.arg(post_id)
+WHERE (w.feed_id IS NULL OR w.feed_id = p.feed_id)
+  AND EXISTS (
+    SELECT 1 FROM feed_follows ff WHERE ff.user_id = w.user_id AND ff.feed_id = p.feed_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM post_states ps WHERE ps.user_id = w.user_id AND ps.post_id = p.id AND ps.hidden_at IS NOT NULL
+  )
+  AND (
+    cardinality(w.keywords) = 0
+    OR EXISTS (
+      SELECT 1 FROM unnest(w.keywords) AS k(keyword)
+      WHERE position(lower(k.keyword) IN lower(p.title || ' ' || coalesce(p.description, '') || ' ' || coalesce(p.content, ''))) > 0
+    )
+  )
+RETURNING *;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, webhook_id, post_id, event, payload, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2;
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = sqlc.arg(webhook_id)
+  AND (
+    sqlc.narg(before_time)::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg(before_time)::timestamptz, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetWebhookDeliveriesAfter :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = sqlc.arg(webhook_id)
+  AND (created_at, id) > (sqlc.arg(after_time)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: ClaimDueWebhookDeliveries :many
+-- Takes the pending deliveries due for an attempt. Their next attempt is
+-- pushed back by lease_seconds meanwhile, so other instances skip them and
+-- they are tried again if this one stops before recording the outcome.
+UPDATE webhook_deliveries d
+SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg(lease_seconds)::int),
+    updated_at = CURRENT_TIMESTAMP
+FROM webhooks w
+WHERE w.id = d.webhook_id
+  AND d.id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg(row_limit)
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING d.id, d.payload, d.event, d.attempts, w.url, w.secret;
+
+-- name: RecordWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET status = $2,
+    attempts = attempts + 1,
+    response_status = $3,
+    error = $4,
+    next_attempt_at = $5,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
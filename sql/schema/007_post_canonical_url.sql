@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN canonical_url TEXT;
+
+CREATE INDEX posts_canonical_url_idx ON posts (canonical_url);
+
+-- +goose Down
+DROP INDEX posts_canonical_url_idx;
+
+ALTER TABLE posts DROP COLUMN canonical_url;
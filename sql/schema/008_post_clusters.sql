@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN fingerprint BIGINT;
+ALTER TABLE posts ADD COLUMN cluster_id UUID;
+
+UPDATE posts SET cluster_id = id WHERE cluster_id IS NULL;
+
+CREATE INDEX posts_cluster_id_idx ON posts (cluster_id);
+CREATE INDEX posts_published_at_idx ON posts (published_at);
+
+-- +goose Down
+DROP INDEX posts_published_at_idx;
+DROP INDEX posts_cluster_id_idx;
+
+ALTER TABLE posts DROP COLUMN cluster_id;
+ALTER TABLE posts DROP COLUMN fingerprint;
@@ -0,0 +1,109 @@
+-- +goose Up
+
+-- Feeds are now stored once per URL. Every duplicate is merged into the
+-- oldest feed with the same URL.
+CREATE TEMPORARY TABLE feed_merges AS
+SELECT id AS duplicate_id,
+       first_value(id) OVER (PARTITION BY url ORDER BY created_at NULLS LAST, id) AS canonical_id
+FROM feeds;
+
+DELETE FROM feed_merges WHERE duplicate_id = canonical_id;
+
+-- Subscriptions carry the per-user settings that used to live on the feed row.
+ALTER TABLE feed_follows ADD COLUMN title TEXT;
+
+UPDATE feed_follows ff
+SET title = f.title
+FROM feed_merges m
+JOIN feeds f ON f.id = m.duplicate_id
+JOIN feeds c ON c.id = m.canonical_id
+WHERE ff.feed_id = m.duplicate_id
+  AND ff.user_id = f.user_id
+  AND f.title <> c.title;
+
+-- A user following several copies of the same feed keeps a single follow.
+DELETE FROM feed_follows ff
+USING (
+    SELECT ff2.id,
+           row_number() OVER (
+               PARTITION BY ff2.user_id, COALESCE(m.canonical_id, ff2.feed_id)
+               ORDER BY ff2.created_at NULLS LAST, ff2.id
+           ) AS rn
+    FROM feed_follows ff2
+    LEFT JOIN feed_merges m ON m.duplicate_id = ff2.feed_id
+) d
+WHERE ff.id = d.id AND d.rn > 1;
+
+UPDATE feed_follows ff
+SET feed_id = m.canonical_id
+FROM feed_merges m
+WHERE ff.feed_id = m.duplicate_id;
+
+-- Posts belong to the feed, a post is stored once per feed and URL.
+ALTER TABLE posts DROP CONSTRAINT posts_userid_feed_id_key;
+
+DELETE FROM posts p
+USING (
+    SELECT p2.id,
+           row_number() OVER (
+               PARTITION BY COALESCE(m.canonical_id, p2.feed_id), p2.url
+               ORDER BY p2.created_at NULLS LAST, p2.id
+           ) AS rn
+    FROM posts p2
+    LEFT JOIN feed_merges m ON m.duplicate_id = p2.feed_id
+) d
+WHERE p.id = d.id AND d.rn > 1;
+
+UPDATE posts p
+SET feed_id = m.canonical_id
+FROM feed_merges m
+WHERE p.feed_id = m.duplicate_id;
+
+ALTER TABLE posts DROP COLUMN userId;
+ALTER TABLE posts ADD CONSTRAINT posts_feed_id_url_key UNIQUE (feed_id, url);
+
+DELETE FROM feeds f
+USING feed_merges m
+WHERE f.id = m.duplicate_id;
+
+DROP TABLE feed_merges;
+
+-- user_id now records who added the feed, deleting that user must not remove
+-- the feed for everyone else following it.
+ALTER TABLE feeds DROP CONSTRAINT feeds_user_id_url_key;
+ALTER TABLE feeds ADD CONSTRAINT feeds_url_key UNIQUE (url);
+ALTER TABLE feeds DROP CONSTRAINT feeds_user_id_fkey;
+ALTER TABLE feeds ADD CONSTRAINT feeds_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- +goose Down
+
+-- Merged feeds are not split again, posts are attributed to the feed creator.
+ALTER TABLE feeds DROP CONSTRAINT feeds_user_id_fkey;
+ALTER TABLE feeds ADD CONSTRAINT feeds_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE feeds DROP CONSTRAINT feeds_url_key;
+ALTER TABLE feeds ADD CONSTRAINT feeds_user_id_url_key UNIQUE (user_id, url);
+
+ALTER TABLE posts DROP CONSTRAINT posts_feed_id_url_key;
+ALTER TABLE posts ADD COLUMN userId UUID REFERENCES users(id) ON DELETE CASCADE;
+
+UPDATE posts p
+SET userId = f.user_id
+FROM feeds f
+WHERE f.id = p.feed_id;
+
+-- The old schema held a single post per user and feed, the first one stored.
+-- The others are deleted, they can't be brought back by migrating up again.
+DELETE FROM posts p
+USING (
+    SELECT p2.id,
+           row_number() OVER (
+               PARTITION BY p2.userId, p2.feed_id
+               ORDER BY p2.created_at NULLS LAST, p2.id
+           ) AS rn
+    FROM posts p2
+) d
+WHERE p.id = d.id AND d.rn > 1;
+
+ALTER TABLE posts ADD CONSTRAINT posts_userid_feed_id_key UNIQUE (userId, feed_id);
+
+ALTER TABLE feed_follows DROP COLUMN title;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE feeds ADD COLUMN poll_interval_minutes INT;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN poll_interval_minutes;
+ALTER TABLE feeds DROP COLUMN enabled;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC, id DESC);
+CREATE INDEX feeds_created_at_idx ON feeds (created_at DESC, id DESC);
+CREATE INDEX feed_follows_user_id_created_at_idx ON feed_follows (user_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX feed_follows_user_id_created_at_idx;
+DROP INDEX feeds_created_at_idx;
+DROP INDEX posts_feed_id_published_at_idx;
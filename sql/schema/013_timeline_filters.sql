@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN attachments JSONB NOT NULL DEFAULT '[]';
+
+CREATE INDEX posts_feed_id_created_at_idx ON posts (feed_id, created_at DESC, id DESC);
+CREATE INDEX posts_with_attachments_idx ON posts (feed_id, published_at DESC, id DESC)
+    WHERE attachments <> '[]'::jsonb;
+
+-- +goose Down
+DROP INDEX posts_with_attachments_idx;
+DROP INDEX posts_feed_id_created_at_idx;
+
+ALTER TABLE posts DROP COLUMN attachments;
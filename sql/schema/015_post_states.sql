@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- A row records what a user did with a post. Posts without a row, or with a
+-- NULL read_at, are unread.
+CREATE TABLE post_states (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX post_states_post_id_idx ON post_states (post_id);
+
+-- +goose Down
+DROP TABLE post_states;
@@ -0,0 +1,27 @@
+-- +goose Up
+
+-- Starring a post saves a copy of it. The copy outlives the post, which is
+-- deleted along with its feed, so post_id and feed_id only point back at the
+-- originals while they exist.
+CREATE TABLE starred_posts (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID REFERENCES posts(id) ON DELETE SET NULL,
+    feed_id UUID REFERENCES feeds(id) ON DELETE SET NULL,
+    feed_title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    content TEXT,
+    attachments JSONB NOT NULL DEFAULT '[]',
+    published_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, post_id)
+);
+
+CREATE INDEX starred_posts_user_id_created_at_idx ON starred_posts (user_id, created_at DESC, id DESC);
+CREATE INDEX starred_posts_post_id_idx ON starred_posts (post_id);
+
+-- +goose Down
+DROP TABLE starred_posts;
@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- Folders group a user's feed follows. A folder sits at the top level or
+-- inside a top-level folder, the API doesn't allow deeper nesting.
+CREATE TABLE folders (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX folders_user_id_name_key ON folders (user_id, name) WHERE parent_id IS NULL;
+CREATE UNIQUE INDEX folders_parent_id_name_key ON folders (parent_id, name) WHERE parent_id IS NOT NULL;
+
+-- Deleting a folder leaves its feeds followed, outside of any folder.
+ALTER TABLE feed_follows ADD COLUMN folder_id UUID REFERENCES folders(id) ON DELETE SET NULL;
+
+CREATE INDEX feed_follows_folder_id_idx ON feed_follows (folder_id);
+
+-- +goose Down
+ALTER TABLE feed_follows DROP COLUMN folder_id;
+
+DROP TABLE folders;
@@ -0,0 +1,31 @@
+-- +goose Up
+
+-- OPML files are imported in the background, one row per file with one item
+-- per feed found in it.
+CREATE TABLE opml_imports (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE opml_import_items (
+    id UUID PRIMARY KEY,
+    import_id UUID NOT NULL REFERENCES opml_imports(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL,
+    folder TEXT NOT NULL,
+    subfolder TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    feed_id UUID REFERENCES feeds(id) ON DELETE SET NULL,
+    error TEXT,
+    UNIQUE(import_id, position)
+);
+
+-- +goose Down
+DROP TABLE opml_import_items;
+DROP TABLE opml_imports;
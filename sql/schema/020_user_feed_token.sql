@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- Feed readers can't send the X-API-Key header, the published timeline is
+-- authenticated by a separate token carried in its URL.
+ALTER TABLE users ADD COLUMN feed_token VARCHAR(255) UNIQUE NOT NULL DEFAULT (
+    encode(sha256(random()::text::bytea), 'hex')
+);
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN feed_token;
@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- Collections are named sets of feeds a user publishes under a public slug.
+CREATE TABLE collections (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE collection_feeds (
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, feed_id)
+);
+
+-- Subscribers follow every feed of the collection when they subscribe, and
+-- the feeds added later when track_additions is set.
+CREATE TABLE collection_subscriptions (
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    track_additions BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, user_id)
+);
+
+CREATE INDEX collections_user_id_idx ON collections (user_id);
+CREATE INDEX collection_subscriptions_user_id_idx ON collection_subscriptions (user_id);
+
+-- +goose Down
+DROP TABLE collection_subscriptions;
+DROP TABLE collection_feeds;
+DROP TABLE collections;
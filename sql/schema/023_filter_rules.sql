@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- Filter rules can match on the author and categories of posts.
+ALTER TABLE posts ADD COLUMN author TEXT;
+ALTER TABLE posts ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+
+-- Hidden posts are left out of the timeline.
+ALTER TABLE post_states ADD COLUMN hidden_at TIMESTAMP WITH TIME ZONE;
+
+-- Rules are evaluated against every new post of the feeds their user follows,
+-- or of the one follow they are scoped to. A rule matches with regex when it
+-- is set, with any of keywords otherwise.
+CREATE TABLE filter_rules (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_follow_id UUID REFERENCES feed_follows(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    field TEXT NOT NULL,
+    keywords TEXT[] NOT NULL DEFAULT '{}',
+    regex TEXT,
+    action TEXT NOT NULL,
+    tag TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX filter_rules_user_id_idx ON filter_rules (user_id);
+
+-- +goose Down
+DROP TABLE filter_rules;
+ALTER TABLE post_states DROP COLUMN hidden_at;
+ALTER TABLE posts DROP COLUMN categories;
+ALTER TABLE posts DROP COLUMN author;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- Posts are numbered in the order they are stored. The post stream uses the
+-- number as its event ID and resumes after the last one a client saw.
+ALTER TABLE posts ADD COLUMN seq BIGSERIAL NOT NULL;
+
+CREATE UNIQUE INDEX posts_seq_idx ON posts (seq);
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN seq;
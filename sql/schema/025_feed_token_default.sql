@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- Feed tokens are generated by the application from a cryptographically
+-- secure source, random() is predictable.
+ALTER TABLE users ALTER COLUMN feed_token DROP DEFAULT;
+
+-- The tokens handed out so far came from random(), they are all replaced.
+-- The published timeline URLs using them stop working.
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+UPDATE users SET feed_token = encode(gen_random_bytes(32), 'hex'), updated_at = CURRENT_TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users ALTER COLUMN feed_token SET DEFAULT (
+    encode(sha256(random()::text::bytea), 'hex')
+);
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newSecretToken returns 32 random bytes, hex encoded, for the secrets users
+// are identified or trusted by: feed tokens and webhook secrets.
+func newSecretToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
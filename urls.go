@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttributes lists the HTML attributes that carry a single URL and need
+// to be made absolute when they appear in feed content.
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"poster":     true,
+	"cite":       true,
+	"background": true,
+	"longdesc":   true,
+}
+
+// resolveFeedURLs makes every item link, enclosure and every URL embedded in
+// item descriptions absolute. Relative references are resolved against the
+// closest xml:base, then the channel link, then the URL the feed was
+// fetched from.
+func resolveFeedURLs(feed *RSSFeed) {
+	base := parseBaseURL(nil, feed.FetchURL)
+	base = parseBaseURL(base, feed.Base)
+	base = parseBaseURL(base, feed.Channel.Base)
+
+	// The channel link points at the website rather than the feed, but it is
+	// what most publishers expect relative item links to be resolved against.
+	if feed.Channel.Base == "" && feed.Base == "" {
+		base = parseBaseURL(base, strings.TrimSpace(feed.Channel.Link))
+	}
+	feed.Channel.Link = resolveURL(base, feed.Channel.Link)
+
+	for i := range feed.Channel.Items {
+		item := &feed.Channel.Items[i]
+		itemBase := parseBaseURL(base, item.Base)
+
+		item.Link = resolveURL(itemBase, item.Link)
+		for j := range item.Enclosures {
+			item.Enclosures[j].URL = resolveURL(itemBase, item.Enclosures[j].URL)
+		}
+		item.Description = resolveHTMLURLs(itemBase, item.Description)
+	}
+}
+
+// parseBaseURL resolves ref against base and returns the result, falling back
+// to base when ref is empty or cannot be parsed.
+func parseBaseURL(base *url.URL, ref string) *url.URL {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return base
+	}
+
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return base
+	}
+
+	if base == nil {
+		return parsed
+	}
+	return base.ResolveReference(parsed)
+}
+
+// resolveURL returns ref as an absolute URL. References that are already
+// absolute, fragments, or that cannot be parsed are returned unchanged.
+func resolveURL(base *url.URL, ref string) string {
+	trimmed := strings.TrimSpace(ref)
+	if base == nil || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return ref
+	}
+
+	parsed, err := url.Parse(trimmed)
+	if err != nil || parsed.IsAbs() {
+		return ref
+	}
+
+	return base.ResolveReference(parsed).String()
+}
+
+// resolveSrcset resolves every candidate URL of a srcset attribute value,
+// keeping the width/density descriptors as they are.
+func resolveSrcset(base *url.URL, srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = resolveURL(base, fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// resolveHTMLURLs rewrites URL attributes in an HTML fragment so they are
+// absolute. Tags without relative URLs are copied through byte for byte.
+func resolveHTMLURLs(base *url.URL, content string) string {
+	if base == nil || !strings.Contains(content, "<") {
+		return content
+	}
+
+	var out bytes.Buffer
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				// Malformed markup, keep what the publisher sent.
+				return content
+			}
+			break
+		}
+
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			out.Write(tokenizer.Raw())
+			continue
+		}
+
+		// Token reuses the tokenizer's buffer, so keep a copy of the raw tag.
+		raw := append([]byte(nil), tokenizer.Raw()...)
+
+		token := tokenizer.Token()
+		changed := false
+		for i, attr := range token.Attr {
+			key := strings.ToLower(attr.Key)
+
+			var resolved string
+			switch {
+			case urlAttributes[key]:
+				resolved = resolveURL(base, attr.Val)
+			case key == "srcset":
+				resolved = resolveSrcset(base, attr.Val)
+			default:
+				continue
+			}
+
+			if resolved != attr.Val {
+				token.Attr[i].Val = resolved
+				changed = true
+			}
+		}
+
+		if changed {
+			out.WriteString(token.String())
+		} else {
+			out.Write(raw)
+		}
+	}
+
+	return out.String()
+}
+
+// defaultTrackingParams are the query parameters stripped from post URLs
+// when TRACKING_PARAMS is not set. Entries ending in "*" match by prefix.
+var defaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "msclkid", "yclid", "igshid",
+	"mc_cid", "mc_eid", "_hsenc", "_hsmi", "ref", "ref_src", "spm",
+}
+
+// urlCanonicalizer normalizes post URLs so the same article reached through
+// different feeds or campaigns ends up with the same canonical URL.
+type urlCanonicalizer struct {
+	params   map[string]bool
+	prefixes []string
+}
+
+// newURLCanonicalizer builds a canonicalizer from a comma separated list of
+// tracking parameters, falling back to defaultTrackingParams when empty.
+func newURLCanonicalizer(trackingParams string) *urlCanonicalizer {
+	names := defaultTrackingParams
+	if strings.TrimSpace(trackingParams) != "" {
+		names = strings.Split(trackingParams, ",")
+	}
+
+	c := &urlCanonicalizer{params: map[string]bool{}}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if strings.HasSuffix(name, "*") {
+			c.prefixes = append(c.prefixes, strings.TrimSuffix(name, "*"))
+			continue
+		}
+		c.params[name] = true
+	}
+	return c
+}
+
+func (c *urlCanonicalizer) isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	if c.params[name] {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalize lowercases the scheme and host, drops default ports, the
+// fragment and tracking parameters, and sorts what is left of the query.
+// URLs that aren't absolute http(s) URLs are returned unchanged.
+func (c *urlCanonicalizer) canonicalize(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || !parsed.IsAbs() {
+		return rawURL
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return rawURL
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsed.Host = host
+
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	query := parsed.Query()
+	for name := range query {
+		if c.isTrackingParam(name) {
+			query.Del(name)
+		}
+	}
+	// Encode sorts by key, which also makes parameter order irrelevant.
+	parsed.RawQuery = query.Encode()
+	parsed.ForceQuery = false
+
+	return parsed.String()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name           string
+		trackingParams string
+		input          string
+		want           string
+	}{
+		{name: "lowercases scheme and host", input: "HTTPS://Example.COM/Path", want: "https://example.com/Path"},
+		{name: "adds root path", input: "https://example.com", want: "https://example.com/"},
+		{name: "drops http default port", input: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "drops https default port", input: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "keeps other ports", input: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "keeps port of the other scheme", input: "http://example.com:443/a", want: "http://example.com:443/a"},
+		{name: "ipv6 host", input: "https://[2001:DB8::1]/a", want: "https://[2001:db8::1]/a"},
+		{name: "ipv6 host with default port", input: "https://[2001:db8::1]:443/a", want: "https://[2001:db8::1]/a"},
+		{name: "ipv6 host with port", input: "http://[::1]:8080/a", want: "http://[::1]:8080/a"},
+		{name: "drops fragment", input: "https://example.com/a#comments", want: "https://example.com/a"},
+		{name: "drops tracking params", input: "https://example.com/a?utm_source=rss&utm_medium=feed&fbclid=x", want: "https://example.com/a"},
+		{name: "tracking params ignore case", input: "https://example.com/a?UTM_Source=rss&id=1", want: "https://example.com/a?id=1"},
+		{name: "sorts query", input: "https://example.com/a?b=2&a=1", want: "https://example.com/a?a=1&b=2"},
+		{name: "drops empty query", input: "https://example.com/a?", want: "https://example.com/a"},
+		{name: "custom params", trackingParams: "session, src_*", input: "https://example.com/a?session=1&src_x=2&utm_source=rss", want: "https://example.com/a?utm_source=rss"},
+		{name: "relative url unchanged", input: "/a?utm_source=rss", want: "/a?utm_source=rss"},
+		{name: "other scheme unchanged", input: "ftp://Example.com/a", want: "ftp://Example.com/a"},
+		{name: "invalid url unchanged", input: "https://example.com/%zz", want: "https://example.com/%zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newURLCanonicalizer(tt.trackingParams).canonicalize(tt.input)
+			if got != tt.want {
+				t.Errorf("canonicalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHTMLURLs(t *testing.T) {
+	base, err := url.Parse("https://example.com/blog/post/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		base    *url.URL
+		content string
+		want    string
+	}{
+		{name: "relative href", base: base, content: `<a href="../other/">x</a>`, want: `<a href="https://example.com/blog/other/">x</a>`},
+		{name: "root relative src", base: base, content: `<img src="/img/a.png">`, want: `<img src="https://example.com/img/a.png">`},
+		{name: "absolute url copied as is", base: base, content: `<a HREF='https://other.org/'>x</a>`, want: `<a HREF='https://other.org/'>x</a>`},
+		{name: "fragment kept", base: base, content: `<a href="#note-1">1</a>`, want: `<a href="#note-1">1</a>`},
+		{name: "srcset candidates", base: base, content: `<img srcset="a.png 1x, /b.png 2x">`, want: `<img srcset="https://example.com/blog/post/a.png 1x, https://example.com/b.png 2x">`},
+		{name: "srcset widths", base: base, content: `<img srcset="small.jpg 480w,large.jpg 1080w">`, want: `<img srcset="https://example.com/blog/post/small.jpg 480w, https://example.com/blog/post/large.jpg 1080w">`},
+		{name: "srcset absolute kept", base: base, content: `<img srcset="https://cdn.example.com/a.png 2x">`, want: `<img srcset="https://cdn.example.com/a.png 2x">`},
+		{name: "other attributes untouched", base: base, content: `<p class="x">text &amp; more</p>`, want: `<p class="x">text &amp; more</p>`},
+		{name: "plain text", base: base, content: "no markup", want: "no markup"},
+		{name: "no base", base: nil, content: `<a href="/a">x</a>`, want: `<a href="/a">x</a>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveHTMLURLs(tt.base, tt.content)
+			if got != tt.want {
+				t.Errorf("resolveHTMLURLs(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
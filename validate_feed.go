@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// feedValidationTimeout bounds the test fetch done when a feed is created.
+const feedValidationTimeout = 15 * time.Second
+
+const (
+	feedErrorMalformed   = "malformed"
+	feedErrorUnreachable = "unreachable"
+	feedErrorNotAFeed    = "not_a_feed"
+	feedErrorUnsupported = "unsupported_format"
+)
+
+// errUnsupportedFeedFormat is returned when a website only offers feeds the
+// scraper can't read, Atom and JSON Feed.
+var errUnsupportedFeedFormat = errors.New("unsupported feed format")
+
+// feedValidationError explains why a feed URL was rejected. It is returned
+// to clients as is with a 422 status.
+type feedValidationError struct {
+	Message string `json:"error"`
+	Reason  string `json:"reason"`
+	URL     string `json:"url"`
+}
+
+func (e *feedValidationError) Error() string {
+	return e.Reason + ": " + e.Message
+}
+
+// validateFeedURL checks that rawURL is an absolute http(s) URL.
+func validateFeedURL(rawURL string) *feedValidationError {
+	invalid := func(message string) *feedValidationError {
+		return &feedValidationError{Message: message, Reason: feedErrorMalformed, URL: rawURL}
+	}
+
+	if strings.TrimSpace(rawURL) == "" {
+		return invalid("url is required")
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return invalid("url could not be parsed")
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return invalid("url must use the http or https scheme")
+	}
+	if parsed.Host == "" {
+		return invalid("url must include a host")
+	}
+	return nil
+}
+
+// testFetchFeed resolves rawURL to a feed, following autodiscovery when it
+// points at a website, and makes sure the feed can be fetched and parsed.
+// Only RSS feeds are considered, they are tried in the order they were
+// discovered until one can be read.
+func testFetchFeed(ctx context.Context, client *fetcher, rawURL string) (FeedCandidate, RSSFeed, *feedValidationError) {
+	ctx, cancel := context.WithTimeout(ctx, feedValidationTimeout)
+	defer cancel()
+
+	candidates, err := discoverFeeds(ctx, client, rawURL)
+	if err != nil {
+		return FeedCandidate{}, RSSFeed{}, feedErrorFrom(rawURL, err)
+	}
+
+	var firstErr *feedValidationError
+	for _, candidate := range candidates {
+		if candidate.Type != "rss" {
+			continue
+		}
+
+		rssFeed, err := urlToFeed(ctx, client, candidate.URL)
+		if err == nil {
+			return candidate, rssFeed, nil
+		}
+		if firstErr == nil {
+			firstErr = feedErrorFrom(candidate.URL, err)
+		}
+	}
+
+	if firstErr == nil {
+		return FeedCandidate{}, RSSFeed{}, feedErrorFrom(rawURL, errUnsupportedFeedFormat)
+	}
+	return FeedCandidate{}, RSSFeed{}, firstErr
+}
+
+func feedErrorFrom(rawURL string, err error) *feedValidationError {
+	switch {
+	case errors.Is(err, errNonPublicAddress):
+		return &feedValidationError{Message: "url must point to a public address", Reason: feedErrorMalformed, URL: rawURL}
+	case errors.Is(err, errFeedUnreachable) || errors.Is(err, context.DeadlineExceeded):
+		return &feedValidationError{Message: "url could not be fetched: " + err.Error(), Reason: feedErrorUnreachable, URL: rawURL}
+	case errors.Is(err, errUnsupportedFeedFormat):
+		return &feedValidationError{Message: "url only offers Atom or JSON feeds, only RSS feeds are supported", Reason: feedErrorUnsupported, URL: rawURL}
+	case errors.Is(err, errNoFeedFound):
+		return &feedValidationError{Message: "url is not a feed and does not link to one", Reason: feedErrorNotAFeed, URL: rawURL}
+	default:
+		return &feedValidationError{Message: "url is not a valid RSS feed: " + err.Error(), Reason: feedErrorNotAFeed, URL: rawURL}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTestFetchFeed(t *testing.T) {
+	const rss = `<rss version="2.0"><channel><title>Blog</title><link>https://example.com/</link></channel></rss>`
+	const atom = `<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title></feed>`
+
+	page := func(links ...string) string {
+		html := "<html><head>"
+		for _, link := range links {
+			html += link
+		}
+		return html + "</head><body></body></html>"
+	}
+
+	mux := http.NewServeMux()
+	serve := func(path, contentType, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			fmt.Fprint(w, body)
+		})
+	}
+	serve("/rss.xml", "application/rss+xml", rss)
+	serve("/atom.xml", "application/atom+xml", atom)
+	serve("/broken.xml", "application/rss+xml", "<rss><channel>")
+	serve("/atom-only", "text/html", page(`<link rel="alternate" type="application/atom+xml" href="/atom.xml">`))
+	serve("/mixed", "text/html", page(
+		`<link rel="alternate" type="application/atom+xml" href="/atom.xml">`,
+		`<link rel="alternate" type="application/rss+xml" href="/broken.xml">`,
+		`<link rel="alternate" type="application/rss+xml" href="/rss.xml">`,
+	))
+	serve("/all-broken", "text/html", page(`<link rel="alternate" type="application/rss+xml" href="/broken.xml">`))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := newFetcher(fetchTimeout, maxRequestsPerHost, addressGuard{allowPrivate: true})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantURL    string
+		wantReason string
+	}{
+		{name: "rss feed", path: "/rss.xml", wantURL: "/rss.xml"},
+		{name: "atom feed", path: "/atom.xml", wantReason: feedErrorUnsupported},
+		{name: "page with only atom", path: "/atom-only", wantReason: feedErrorUnsupported},
+		{name: "first readable rss feed", path: "/mixed", wantURL: "/rss.xml"},
+		{name: "no readable rss feed", path: "/all-broken", wantReason: feedErrorNotAFeed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidate, _, validationErr := testFetchFeed(context.Background(), client, server.URL+tt.path)
+			if tt.wantReason != "" {
+				if validationErr == nil || validationErr.Reason != tt.wantReason {
+					t.Fatalf("testFetchFeed() error = %v, want reason %q", validationErr, tt.wantReason)
+				}
+				return
+			}
+			if validationErr != nil {
+				t.Fatalf("testFetchFeed() error = %v", validationErr)
+			}
+			if candidate.URL != server.URL+tt.wantURL {
+				t.Errorf("testFetchFeed() feed = %q, want %q", candidate.URL, server.URL+tt.wantURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/darthvadr/rss-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	webhookEventPost = "post.created"
+	webhookEventPing = "ping"
+
+	webhookStatusPending   = "pending"
+	webhookStatusSucceeded = "succeeded"
+	webhookStatusFailed    = "failed"
+)
+
+const (
+	// maxWebhookAttempts is how many times a delivery is tried before it is
+	// given up, over about an hour
+	maxWebhookAttempts = 8
+	// webhookRetryBase is the wait after the first failed attempt, doubled
+	// after every further one
+	webhookRetryBase = 30 * time.Second
+	webhookTimeout   = 10 * time.Second
+	// webhookLease keeps other instances off a delivery being attempted
+	webhookLease        = 2 * time.Minute
+	webhookPollInterval = 10 * time.Second
+	webhookBatchSize    = 20
+)
+
+// webhookStatusError is a response with a status other than 2xx.
+type webhookStatusError int
+
+func (e webhookStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", int(e))
+}
+
+// webhookPayload is the JSON body POSTed to webhooks.
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	WebhookID uuid.UUID `json:"webhook_id"`
+	Post      *Post     `json:"post,omitempty"`
+}
+
+// webhookAttempt is a delivery about to be sent.
+type webhookAttempt struct {
+	ID      uuid.UUID
+	URL     string
+	Secret  string
+	Event   string
+	Payload []byte
+}
+
+// webhookDispatcher sends the queued webhook deliveries and retries the
+// failed ones. Deliveries live in the database, any instance may send them.
+type webhookDispatcher struct {
+	db     *database.Queries
+	guard  addressGuard
+	client *http.Client
+	wake   chan struct{}
+}
+
+func newWebhookDispatcher(db *database.Queries, guard addressGuard) *webhookDispatcher {
+	return &webhookDispatcher{
+		db:    db,
+		guard: guard,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: guard.transport(),
+			// A redirected POST turns into a GET, the delivery fails instead
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+func (d *webhookDispatcher) start() {
+	log.Println("Starting webhook dispatcher with interval:", webhookPollInterval)
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(context.Background())
+
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// enqueuePost queues a delivery of a new post for every webhook it matches.
+func (d *webhookDispatcher) enqueuePost(ctx context.Context, post database.Post) {
+	// The webhook ID is filled in by the database, per delivery
+	apiPost := databaseToPost(post)
+	payload, err := json.Marshal(webhookPayload{Event: webhookEventPost, Post: &apiPost})
+	if err != nil {
+		log.Println("Error encoding webhook payload: ", fmt.Errorf("error encoding webhook payload: %w", err))
+		return
+	}
+
+	deliveries, err := d.db.CreateWebhookDeliveriesForPost(ctx, database.CreateWebhookDeliveriesForPostParams{
+		Payload: payload,
+		PostID:  post.ID,
+	})
+	if err != nil {
+		log.Println("Error queuing webhook deliveries: ", fmt.Errorf("error queuing webhook deliveries: %w", err))
+		return
+	}
+
+	if len(deliveries) > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliverDue sends the deliveries due, a batch at a time.
+func (d *webhookDispatcher) deliverDue(ctx context.Context) {
+	for {
+		claimed, err := d.db.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+			LeaseSeconds: int32(webhookLease.Seconds()),
+			RowLimit:     webhookBatchSize,
+		})
+		if err != nil {
+			log.Println("Error claiming webhook deliveries: ", fmt.Errorf("error claiming webhook deliveries: %w", err))
+			return
+		}
+
+		wg := sync.WaitGroup{}
+		for _, delivery := range claimed {
+			wg.Add(1)
+			go func(delivery database.ClaimDueWebhookDeliveriesRow) {
+				defer wg.Done()
+
+				if _, err := d.attempt(ctx, webhookAttempt{
+					ID:      delivery.ID,
+					URL:     delivery.Url,
+					Secret:  delivery.Secret,
+					Event:   delivery.Event,
+					Payload: delivery.Payload,
+				}, delivery.Attempts); err != nil {
+					log.Println("Error recording webhook delivery: ", fmt.Errorf("error recording webhook delivery %s: %w", delivery.ID, err))
+				}
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(claimed) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// deliverNow queues a delivery to webhook and makes its first attempt right
+// away. Retries are left to the dispatcher.
+func (d *webhookDispatcher) deliverNow(ctx context.Context, webhook database.Webhook, postID uuid.NullUUID, event string, payload []byte) (database.WebhookDelivery, error) {
+	// Leased from the start, the dispatcher must not send it at the same time
+	delivery, err := d.db.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+		ID:            uuid.New(),
+		WebhookID:     webhook.ID,
+		PostID:        postID,
+		Event:         event,
+		Payload:       payload,
+		NextAttemptAt: sql.NullTime{Time: time.Now().Add(webhookLease), Valid: true},
+	})
+	if err != nil {
+		return delivery, err
+	}
+
+	return d.attempt(ctx, webhookAttempt{
+		ID:      delivery.ID,
+		URL:     webhook.Url,
+		Secret:  webhook.Secret,
+		Event:   delivery.Event,
+		Payload: delivery.Payload,
+	}, delivery.Attempts)
+}
+
+// attempt sends a delivery and records the outcome: succeeded, pending until
+// the next attempt or failed for good. previousAttempts is how many times it
+// was sent before.
+func (d *webhookDispatcher) attempt(ctx context.Context, attempt webhookAttempt, previousAttempts int32) (database.WebhookDelivery, error) {
+	statusCode, err := d.send(ctx, attempt)
+
+	record := database.RecordWebhookDeliveryAttemptParams{
+		ID:             attempt.ID,
+		Status:         webhookStatusSucceeded,
+		ResponseStatus: sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+	}
+	if err != nil {
+		record.Error = sql.NullString{String: webhookErrorMessage(err), Valid: true}
+
+		attempts := previousAttempts + 1
+		if attempts >= maxWebhookAttempts {
+			record.Status = webhookStatusFailed
+		} else {
+			record.Status = webhookStatusPending
+			record.NextAttemptAt = sql.NullTime{Time: time.Now().Add(webhookBackoff(attempts)), Valid: true}
+		}
+	}
+
+	return d.db.RecordWebhookDeliveryAttempt(ctx, record)
+}
+
+// send POSTs the payload, any response but a 2xx is a failure. The status
+// code is 0 when no response was received.
+func (d *webhookDispatcher) send(ctx context.Context, attempt webhookAttempt) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, attempt.URL, bytes.NewReader(attempt.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Webhook-Event", attempt.Event)
+	req.Header.Set("X-Webhook-Delivery", attempt.ID.String())
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhookPayload(attempt.Secret, timestamp, attempt.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, webhookStatusError(resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookErrorMessage is the error recorded for a failed attempt. Users see
+// it, connection errors are summed up rather than telling them how the
+// server's network answered.
+func webhookErrorMessage(err error) string {
+	var statusErr webhookStatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Error()
+	case errors.Is(err, errNonPublicAddress):
+		return "address is not public"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timed out"
+	}
+	return "connection failed"
+}
+
+// webhookBackoff is how long to wait after the given number of failed
+// attempts.
+func webhookBackoff(attempts int32) time.Duration {
+	return webhookRetryBase << (attempts - 1)
+}
+
+// signWebhookPayload is the HMAC-SHA256 of "<timestamp>.<payload>" keyed by
+// the webhook's secret. The timestamp is signed too so receivers can reject
+// replayed deliveries.
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Computed independently with Python's hmac module
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		payload   string
+		want      string
+	}{
+		{name: "ping", secret: "secret", timestamp: 1700000000, payload: `{"event":"ping"}`, want: "sha256=4d39bd2442f073b6bc62e95d0297ce25475582a17389ab860abdc778fe1d9f77"},
+		{name: "other secret", secret: "other", timestamp: 1700000000, payload: `{"event":"ping"}`, want: "sha256=0b745d77e8146ca45a844ad89177fce05067c8ba592d8a848a1837088acdd617"},
+		{name: "other timestamp", secret: "secret", timestamp: 1700000001, payload: `{"event":"ping"}`, want: "sha256=eedea19c4f9746182139222a782f5b9af3e09352c1e1e2a036bddbb27737db4d"},
+		{name: "empty payload", secret: "secret", timestamp: 0, payload: ``, want: "sha256=3445798a051818ef95def46c2eb62b43d377ce6e3c29b4d0aec3da0e59577f79"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signWebhookPayload(tt.secret, tt.timestamp, []byte(tt.payload)); got != tt.want {
+				t.Errorf("signWebhookPayload() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: maxWebhookAttempts - 1, want: 32 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempts), func(t *testing.T) {
+			if got := webhookBackoff(tt.attempts); got != tt.want {
+				t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestWebhookErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "status", err: webhookStatusError(503), want: "unexpected status 503"},
+		{name: "non public address", err: &net.OpError{Op: "dial", Err: fmt.Errorf("%w: 10.0.0.1", errNonPublicAddress)}, want: "address is not public"},
+		{name: "timeout", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: "timed out"},
+		{name: "refused", err: &net.OpError{Op: "dial", Err: errors.New("connect: connection refused")}, want: "connection failed"},
+		{name: "canceled", err: context.Canceled, want: "connection failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := webhookErrorMessage(tt.err); got != tt.want {
+				t.Errorf("webhookErrorMessage(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}